@@ -0,0 +1,98 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrAuthFailed is when the remote repository rejected the credentials, or there were none
+	// to give.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrRemoteNotFound is when the remote repository does not exist.
+	ErrRemoteNotFound = errors.New("remote repository not found")
+	// ErrConflict is when local changes conflict with the remote, or the branch has diverged
+	// from its upstream branch.
+	ErrConflict = errors.New("local changes conflict with the remote")
+)
+
+// Error is a failed git command.
+type Error struct {
+	// Op is the git command that failed (e.g. clone).
+	Op string
+	// Target is the URL or path of the repository.
+	Target string
+	// Err is the cause. It is ErrAuthFailed, ErrRemoteNotFound or ErrConflict when the cause
+	// is known.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return "failed to " + e.Op + " " + e.Target + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// contextErr returns the error of the context when it is done, since git killed by the context
+// only reports its exit status. Otherwise err is returned.
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// newError creates an Error from the output of a failed git command. The cause is determined
+// from the output when git reports a known failure. When the command was stopped because the
+// context is done, the cause is the error of the context.
+func newError(ctx context.Context, op string, target string, out []byte, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return &Error{Op: op, Target: target, Err: ctxErr}
+	}
+	cause := classify(out)
+	if cause == nil {
+		cause = err
+		if _, ok := err.(*exec.ExitError); ok {
+			if msg := lastLine(out); msg != "" {
+				cause = errors.New(msg)
+			}
+		}
+	}
+	return &Error{Op: op, Target: target, Err: cause}
+}
+
+func classify(out []byte) error {
+	s := strings.ToLower(string(out))
+	switch {
+	case strings.Contains(s, "authentication failed"),
+		strings.Contains(s, "could not read username"),
+		strings.Contains(s, "permission denied (publickey)"):
+		return ErrAuthFailed
+	case strings.Contains(s, "repository not found"),
+		strings.Contains(s, "does not appear to be a git repository"),
+		strings.Contains(s, "repository '") && strings.Contains(s, "' not found"):
+		return ErrRemoteNotFound
+	case strings.Contains(s, "not possible to fast-forward"),
+		strings.Contains(s, "would be overwritten"),
+		strings.Contains(s, "conflict"):
+		return ErrConflict
+	default:
+		return nil
+	}
+}
+
+// lastLine returns the last non-empty line of the output with any "fatal: " or "error: " prefix
+// removed.
+func lastLine(out []byte) string {
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	line := strings.TrimSpace(string(lines[len(lines)-1]))
+	for _, prefix := range []string{"fatal: ", "error: "} {
+		line = strings.TrimPrefix(line, prefix)
+	}
+	return line
+}
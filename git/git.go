@@ -2,73 +2,309 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
+	"strings"
+	"time"
 )
 
-func IsInstalled(ctx context.Context) bool {
+// Client performs git operations on repositories.
+type Client interface {
+	// IsInstalled determines if git is available.
+	IsInstalled(ctx context.Context) bool
+	// Version returns the version of git (e.g. 2.43.0).
+	Version(ctx context.Context) (string, error)
+	// Clone clones the repository at the URL to the target directory and checks out the ref.
+	// When the ref is empty, the default branch is cloned. Semver constraints must be resolved
+	// to a tag first. When progress is not nil, it is called with the progress git reports.
+	Clone(ctx context.Context, url string, ref Ref, targetDir string, progress func(CloneProgress)) error
+	// FastForward fast-forwards the current branch of the repository at the path to its
+	// upstream branch. It fails if the branches have diverged.
+	FastForward(ctx context.Context, path string) error
+	// SubmoduleUpdate initializes and updates the submodules of the repository at the path.
+	SubmoduleUpdate(ctx context.Context, path string) error
+	// RevParse resolves the ref (e.g. HEAD) of the repository at the path to a commit SHA.
+	RevParse(ctx context.Context, path string, ref string) (string, error)
+	// Fetch fetches the latest changes of the remote of the repository at the path. When
+	// refspecs are given, only they are fetched.
+	Fetch(ctx context.Context, path string, refspecs ...string) error
+	// ListRemoteTags returns the names of the tags of the repository at the URL.
+	ListRemoteTags(ctx context.Context, url string) ([]string, error)
+	// Checkout checks out the ref of the repository at the path.
+	Checkout(ctx context.Context, path string, ref string) error
+	// Reset moves the current branch of the repository at the path to the commit, discarding
+	// any local changes.
+	Reset(ctx context.Context, path string, commit string) error
+	// Status returns the status of the working tree of the repository at the path.
+	Status(ctx context.Context, path string) (Status, error)
+	// Log returns the commits of the repository at the path that are reachable from to but not
+	// from from, newest first.
+	Log(ctx context.Context, path string, from string, to string) ([]Commit, error)
+}
+
+// Commit is a commit of a repository.
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+}
+
+// Status is the status of the working tree of a repository.
+type Status struct {
+	// Dirty is when the working tree has uncommitted changes.
+	Dirty bool
+	// Upstream is the name of the upstream branch (e.g. origin/main) the current branch tracks.
+	// It is empty when there is no upstream branch.
+	Upstream string
+	// Ahead is the number of commits HEAD is ahead of the upstream branch.
+	Ahead int
+	// Behind is the number of commits HEAD is behind the upstream branch.
+	Behind int
+}
+
+// Update fetches the latest changes of the repository at the path, fast-forwards the current
+// branch to them and updates its submodules.
+func Update(ctx context.Context, logger *slog.Logger, client Client, path string) error {
+	logger.Debug("fetching repository", "path", path)
+	if err := client.Fetch(ctx, path); err != nil {
+		return err
+	}
+	logger.Debug("fast-forwarding repository", "path", path)
+	if err := client.FastForward(ctx, path); err != nil {
+		return err
+	}
+	logger.Debug("updating submodule", "path", path)
+	if err := client.SubmoduleUpdate(ctx, path); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ExecClient is a Client that runs the git executable.
+type ExecClient struct {
+	logger *slog.Logger
+}
+
+var _ Client = (*ExecClient)(nil)
+
+// NewExecClient creates a Client that runs the git executable on the PATH.
+func NewExecClient(logger *slog.Logger) *ExecClient {
+	return &ExecClient{logger: logger}
+}
+
+func (c *ExecClient) IsInstalled(ctx context.Context) bool {
 	cmd := exec.CommandContext(ctx, "git", "--version")
 	_, err := cmd.Output()
 	return err == nil
 }
 
-func Clone(logger *slog.Logger, url string, branch string, targetDir string) error {
+func (c *ExecClient) Version(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "--version")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get version of git: %w", contextErr(ctx, err))
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "git version "), nil
+}
+
+func (c *ExecClient) Clone(ctx context.Context, url string, ref Ref, targetDir string, progress func(CloneProgress)) error {
 	var cmd *exec.Cmd
-	if branch != "" {
-		cmd = exec.Command("git", "clone", "-b", branch, "--single-branch", "--recursive", url, targetDir)
-	} else {
-		cmd = exec.Command("git", "clone", "--single-branch", "--recursive", url, targetDir)
+	switch ref.Type {
+	case RefDefault:
+		cmd = exec.CommandContext(ctx, "git", "clone", "--single-branch", "--recursive", url, targetDir)
+	case RefBranch, RefTag:
+		cmd = exec.CommandContext(ctx, "git", "clone", "-b", ref.Name, "--single-branch", "--recursive", url, targetDir)
+	case RefCommit:
+		// a commit cannot be cloned directly, so every branch is cloned to make sure the commit
+		// is available to checkout
+		cmd = exec.CommandContext(ctx, "git", "clone", "--recursive", url, targetDir)
+	default:
+		return errors.New("cannot clone " + string(ref.Type) + " " + ref.Name + ", it must be resolved to a tag first")
 	}
 
 	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
 
-	logger.Debug("cloning repo", "url", url)
+	c.logger.Debug("cloning repo", "url", url)
+	var out []byte
+	var err error
+	if progress != nil {
+		// git only reports progress to a terminal unless asked to
+		cmd.Args = slices.Insert(cmd.Args, 2, "--progress")
+		w := &progressWriter{fn: progress}
+		cmd.Stdout = w
+		cmd.Stderr = w
+		err = cmd.Run()
+		out = w.Bytes()
+	} else {
+		out, err = cmd.CombinedOutput()
+	}
+	c.logger.Debug("output of git clone", "url", url, "ref", ref.String(), "output", out)
+	if err != nil {
+		return newError(ctx, "clone", url, out, err)
+	}
+
+	if ref.Type == RefCommit {
+		if err = c.Checkout(ctx, targetDir, ref.Name); err != nil {
+			return err
+		}
+		if err = c.SubmoduleUpdate(ctx, targetDir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *ExecClient) FastForward(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "merge", "--ff-only", "--quiet", "@{upstream}")
+
+	c.logger.Debug("fast-forwarding repository", "path", path)
 	out, err := cmd.CombinedOutput()
-	logger.Debug("output of git clone", "url", url, "branch", branch, "output", out)
+	c.logger.Debug("output of git merge", "path", path, "output", out)
 	if err != nil {
-		return fmt.Errorf("failed to clone repository: %w", err)
+		return newError(ctx, "fast-forward", path, out, err)
 	}
+	return nil
+}
 
+func (c *ExecClient) SubmoduleUpdate(ctx context.Context, path string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "submodule", "update", "--init", "--recursive")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return newError(ctx, "update submodules of", path, out, err)
+	}
 	return nil
 }
 
-func Update(logger *slog.Logger, path string) error {
-	logger.Debug("pulling repository", "path", path)
-	if err := pull(path); err != nil {
-		return err
+func (c *ExecClient) RevParse(ctx context.Context, path string, ref string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "rev-parse", "--verify", ref+"^{commit}")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve "+ref+" in "+path+": %w", contextErr(ctx, err))
 	}
-	logger.Debug("updating submodule", "path", path)
-	if err := update(path); err != nil {
-		return err
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c *ExecClient) Fetch(ctx context.Context, path string, refspecs ...string) error {
+	args := []string{"-C", path, "fetch", "--quiet"}
+	if len(refspecs) > 0 {
+		args = append(append(args, "origin"), refspecs...)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	c.logger.Debug("fetching repository", "path", path, "refspecs", refspecs)
+	out, err := cmd.CombinedOutput()
+	c.logger.Debug("output of git fetch", "path", path, "output", out)
+	if err != nil {
+		return newError(ctx, "fetch", path, out, err)
 	}
 	return nil
 }
 
-func pull(path string) error {
-	cmd := exec.Command("git", "-C", path, "pull")
+func (c *ExecClient) ListRemoteTags(ctx context.Context, url string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--tags", "--refs", url)
 	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
-	if err := cmd.Run(); err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			switch exitError.ExitCode() {
-			case 1:
-				return fmt.Errorf("remote repository not found")
-			case 128:
-				return fmt.Errorf("there is a conflict between remote and local changes")
-			default:
-				return fmt.Errorf("failed to pull latest changes: %s", exitError.Error())
-			}
+
+	c.logger.Debug("listing remote tags", "url", url)
+	out, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = exitErr.Stderr
 		}
+		return nil, newError(ctx, "list tags of", url, stderr, err)
+	}
+
+	var tags []string
+	for _, line := range strings.Split(string(out), "\n") {
+		_, ref, found := strings.Cut(line, "\t")
+		if !found {
+			continue
+		}
+		tags = append(tags, strings.TrimPrefix(strings.TrimSpace(ref), "refs/tags/"))
+	}
+	return tags, nil
+}
+
+func (c *ExecClient) Checkout(ctx context.Context, path string, ref string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "checkout", "--quiet", ref)
+
+	c.logger.Debug("checking out ref", "path", path, "ref", ref)
+	out, err := cmd.CombinedOutput()
+	c.logger.Debug("output of git checkout", "path", path, "ref", ref, "output", out)
+	if err != nil {
+		return newError(ctx, "checkout "+ref+" in", path, out, err)
 	}
 	return nil
 }
 
-func update(path string) error {
-	cmd := exec.Command("git", "-C", path, "submodule", "update", "--init", "--recursive")
-	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to perform submodule update: %w", err)
+func (c *ExecClient) Reset(ctx context.Context, path string, commit string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "reset", "--hard", "--quiet", commit)
+
+	c.logger.Debug("resetting repository", "path", path, "commit", commit)
+	out, err := cmd.CombinedOutput()
+	c.logger.Debug("output of git reset", "path", path, "commit", commit, "output", out)
+	if err != nil {
+		return newError(ctx, "reset to "+commit+" in", path, out, err)
 	}
 	return nil
 }
+
+func (c *ExecClient) Status(ctx context.Context, path string) (Status, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "status", "--porcelain")
+	out, err := cmd.Output()
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to get status of "+path+": %w", contextErr(ctx, err))
+	}
+	status := Status{Dirty: len(strings.TrimSpace(string(out))) > 0}
+
+	cmd = exec.CommandContext(ctx, "git", "-C", path, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	out, err = cmd.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+			// the current branch does not track a remote branch
+			return status, nil
+		}
+		return Status{}, fmt.Errorf("failed to get upstream of "+path+": %w", contextErr(ctx, err))
+	}
+	status.Upstream = strings.TrimSpace(string(out))
+
+	cmd = exec.CommandContext(ctx, "git", "-C", path, "rev-list", "--left-right", "--count", "HEAD..."+status.Upstream)
+	out, err = cmd.Output()
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to compare HEAD to "+status.Upstream+" in "+path+": %w", contextErr(ctx, err))
+	}
+	if _, err = fmt.Sscan(string(out), &status.Ahead, &status.Behind); err != nil {
+		return Status{}, fmt.Errorf("failed to parse output of git rev-list: %w", err)
+	}
+
+	return status, nil
+}
+
+func (c *ExecClient) Log(ctx context.Context, path string, from string, to string) ([]Commit, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", path, "log", "--format=%H%x1f%an%x1f%aI%x1f%s", from+".."+to)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log of "+path+": %w", contextErr(ctx, err))
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse date of commit "+fields[0]+": %w", err)
+		}
+		commits = append(commits, Commit{SHA: fields[0], Author: fields[1], Date: date, Subject: fields[3]})
+	}
+	return commits, nil
+}
@@ -0,0 +1,60 @@
+package git_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecClient_CloneProgress(t *testing.T) {
+	remote := newRemote(t)
+
+	client := git.NewExecClient(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var progress []git.CloneProgress
+	err := client.Clone(context.Background(), "file://"+remote, git.Ref{}, filepath.Join(t.TempDir(), "clone"), func(p git.CloneProgress) {
+		progress = append(progress, p)
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, progress)
+	last := progress[len(progress)-1]
+	assert.Equal(t, 100, last.Percent)
+	assert.Equal(t, last.Total, last.Current)
+}
+
+func TestExecClient_Canceled(t *testing.T) {
+	remote := newRemote(t)
+	client := git.NewExecClient(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := client.Clone(ctx, "file://"+remote, git.Ref{}, filepath.Join(t.TempDir(), "clone"), nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = client.RevParse(ctx, remote, "HEAD")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// newRemote creates a repository with a single commit to clone from. The test is skipped when
+// git is not installed.
+func newRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remote := filepath.Join(t.TempDir(), "remote")
+	for _, args := range [][]string{
+		{"init", "--quiet", "-b", "main", remote},
+		{"-C", remote, "-c", "user.name=gtpm", "-c", "user.email=gtpm@example.com", "commit", "--quiet", "--allow-empty", "-m", "initial"},
+	} {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	return remote
+}
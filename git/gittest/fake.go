@@ -0,0 +1,439 @@
+// Package gittest provides an in-memory git.Client for tests.
+package gittest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Piszmog/gtpm/git"
+)
+
+// Fake is an in-memory git.Client. Remote repositories are registered with AddRemote and Push,
+// and cloning creates an empty directory at the target so code inspecting the file system still
+// works.
+type Fake struct {
+	// NotInstalled makes IsInstalled report that git is not available.
+	NotInstalled bool
+	// CloneDelay is how long every Clone takes, or until its context is done, so slow or stuck
+	// clones can be simulated.
+	CloneDelay time.Duration
+
+	mu      sync.Mutex
+	remotes map[string]*remote
+	repos   map[string]*repo
+	errs    map[string]error
+	calls   []Call
+}
+
+var _ git.Client = (*Fake)(nil)
+
+// Call is a recorded call to the Fake.
+type Call struct {
+	// Method is the name of the method called (e.g. Clone).
+	Method string
+	// Args are the arguments the method was called with.
+	Args []string
+}
+
+type remote struct {
+	defaultBranch string
+	// branches are the commits of every branch, oldest first.
+	branches map[string][]string
+	tags     map[string]string
+}
+
+type repo struct {
+	url      string
+	branch   string
+	head     string
+	detached bool
+	dirty    bool
+	// ahead is the number of local commits made on top of base, the commit of the remote they
+	// were made on.
+	ahead int
+	base  string
+}
+
+// NewFake creates a Fake without any remote repositories.
+func NewFake() *Fake {
+	return &Fake{
+		remotes: make(map[string]*remote),
+		repos:   make(map[string]*repo),
+		errs:    make(map[string]error),
+	}
+}
+
+// AddRemote registers a remote repository at the URL whose default branch has the commits
+// (oldest first).
+func (f *Fake) AddRemote(url string, defaultBranch string, commits ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remotes[url] = &remote{
+		defaultBranch: defaultBranch,
+		branches:      map[string][]string{defaultBranch: slices.Clone(commits)},
+		tags:          make(map[string]string),
+	}
+}
+
+// Push adds the commits to the branch of the remote repository at the URL.
+func (f *Fake) Push(url string, branch string, commits ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.remotes[url]
+	r.branches[branch] = append(r.branches[branch], commits...)
+}
+
+// Tag tags the commit of the remote repository at the URL.
+func (f *Fake) Tag(url string, tag string, commit string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remotes[url].tags[tag] = commit
+}
+
+// SetDirty marks the working tree of the repository at the path as having uncommitted changes.
+func (f *Fake) SetDirty(path string, dirty bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.repos[path].dirty = dirty
+}
+
+// Commit makes a local commit in the repository at the path, so it diverges from its remote.
+func (f *Fake) Commit(path string, commit string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := f.repos[path]
+	if r.ahead == 0 {
+		r.base = r.head
+	}
+	r.ahead++
+	r.head = commit
+}
+
+// FailOn makes every call of the method on the URL or path return err.
+func (f *Fake) FailOn(method string, urlOrPath string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[method+" "+urlOrPath] = err
+}
+
+// Head returns the commit checked out by the repository at the path. If there is no repository
+// at the path, an empty string is returned.
+func (f *Fake) Head(path string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r, ok := f.repos[path]; ok {
+		return r.head
+	}
+	return ""
+}
+
+// Calls returns every call made to the Fake in the order they were made.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// record records the call. The error of the call is returned: the error of the context when it
+// is done, or the error set with FailOn.
+func (f *Fake) record(ctx context.Context, method string, args ...string) error {
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+	if err := ctx.Err(); err != nil {
+		return &git.Error{Op: strings.ToLower(method), Target: args[0], Err: err}
+	}
+	return f.errs[method+" "+args[0]]
+}
+
+func (f *Fake) IsInstalled(ctx context.Context) bool {
+	return !f.NotInstalled
+}
+
+// Version returns the version of the Fake. It fails when NotInstalled is set.
+func (f *Fake) Version(ctx context.Context) (string, error) {
+	if f.NotInstalled {
+		return "", errors.New("git is not installed")
+	}
+	return "2.47.0", nil
+}
+
+func (f *Fake) Clone(ctx context.Context, url string, ref git.Ref, targetDir string, progress func(git.CloneProgress)) error {
+	if f.CloneDelay > 0 {
+		select {
+		case <-time.After(f.CloneDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "Clone", url, ref.String(), targetDir); err != nil {
+		if ctx.Err() != nil {
+			// git leaves the directory it was cloning to behind when it is killed
+			_ = os.MkdirAll(targetDir, os.ModePerm)
+		}
+		return err
+	}
+
+	r, ok := f.remotes[url]
+	if !ok {
+		return &git.Error{Op: "clone", Target: url, Err: git.ErrRemoteNotFound}
+	}
+
+	cloned := &repo{url: url}
+	switch ref.Type {
+	case git.RefDefault, git.RefBranch:
+		cloned.branch = ref.Name
+		if cloned.branch == "" {
+			cloned.branch = r.defaultBranch
+		}
+		commits, ok := r.branches[cloned.branch]
+		if !ok {
+			return &git.Error{Op: "clone", Target: url, Err: errors.New("remote branch " + cloned.branch + " not found")}
+		}
+		cloned.head = commits[len(commits)-1]
+	case git.RefTag:
+		commit, ok := r.tags[ref.Name]
+		if !ok {
+			return &git.Error{Op: "clone", Target: url, Err: errors.New("remote tag " + ref.Name + " not found")}
+		}
+		cloned.head, cloned.detached = commit, true
+	case git.RefCommit:
+		commit, ok := f.resolve(url, ref.Name)
+		if !ok {
+			return &git.Error{Op: "checkout " + ref.Name + " in", Target: targetDir, Err: errors.New("reference is not a tree")}
+		}
+		cloned.head, cloned.detached = commit, true
+	default:
+		return errors.New("cannot clone " + string(ref.Type) + " " + ref.Name + ", it must be resolved to a tag first")
+	}
+
+	if _, err := os.Stat(targetDir); err == nil {
+		return &git.Error{Op: "clone", Target: url, Err: errors.New(targetDir + " already exists")}
+	}
+	if err := os.MkdirAll(targetDir, os.ModePerm); err != nil {
+		return err
+	}
+	f.repos[targetDir] = cloned
+	if progress != nil {
+		progress(git.CloneProgress{Phase: "Receiving objects", Percent: 100, Current: 1, Total: 1})
+	}
+	return nil
+}
+
+func (f *Fake) FastForward(ctx context.Context, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "FastForward", path); err != nil {
+		return err
+	}
+
+	r, err := f.repo(path)
+	if err != nil {
+		return err
+	}
+	if r.detached {
+		return &git.Error{Op: "fast-forward", Target: path, Err: errors.New("not on a branch")}
+	}
+	commits := f.remotes[r.url].branches[r.branch]
+	if !slices.Contains(commits, r.head) {
+		return &git.Error{Op: "fast-forward", Target: path, Err: git.ErrConflict}
+	}
+	r.head = commits[len(commits)-1]
+	return nil
+}
+
+func (f *Fake) SubmoduleUpdate(ctx context.Context, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "SubmoduleUpdate", path); err != nil {
+		return err
+	}
+	_, err := f.repo(path)
+	return err
+}
+
+func (f *Fake) RevParse(ctx context.Context, path string, ref string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "RevParse", path, ref); err != nil {
+		return "", err
+	}
+
+	r, err := f.repo(path)
+	if err != nil {
+		return "", err
+	}
+	if ref == "HEAD" {
+		return r.head, nil
+	}
+	commit, ok := f.resolve(r.url, ref)
+	if !ok {
+		return "", fmt.Errorf("failed to resolve %s in %s", ref, path)
+	}
+	return commit, nil
+}
+
+func (f *Fake) Fetch(ctx context.Context, path string, refspecs ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "Fetch", append([]string{path}, refspecs...)...); err != nil {
+		return err
+	}
+	_, err := f.repo(path)
+	return err
+}
+
+func (f *Fake) ListRemoteTags(ctx context.Context, url string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "ListRemoteTags", url); err != nil {
+		return nil, err
+	}
+
+	r, ok := f.remotes[url]
+	if !ok {
+		return nil, &git.Error{Op: "list tags of", Target: url, Err: git.ErrRemoteNotFound}
+	}
+	tags := make([]string, 0, len(r.tags))
+	for tag := range r.tags {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	return tags, nil
+}
+
+func (f *Fake) Checkout(ctx context.Context, path string, ref string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "Checkout", path, ref); err != nil {
+		return err
+	}
+
+	r, err := f.repo(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.remotes[r.url].branches[ref]; ok {
+		commits := f.remotes[r.url].branches[ref]
+		r.branch, r.head, r.detached, r.ahead = ref, commits[len(commits)-1], false, 0
+		return nil
+	}
+	commit, ok := f.resolve(r.url, ref)
+	if !ok {
+		return &git.Error{Op: "checkout " + ref + " in", Target: path, Err: errors.New("reference is not a tree")}
+	}
+	r.head, r.detached, r.ahead = commit, true, 0
+	return nil
+}
+
+func (f *Fake) Reset(ctx context.Context, path string, commit string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "Reset", path, commit); err != nil {
+		return err
+	}
+
+	r, err := f.repo(path)
+	if err != nil {
+		return err
+	}
+	resolved, ok := f.resolve(r.url, commit)
+	if !ok {
+		return &git.Error{Op: "reset to " + commit + " in", Target: path, Err: errors.New("unknown revision")}
+	}
+	r.head, r.dirty, r.ahead = resolved, false, 0
+	return nil
+}
+
+func (f *Fake) Status(ctx context.Context, path string) (git.Status, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "Status", path); err != nil {
+		return git.Status{}, err
+	}
+
+	r, err := f.repo(path)
+	if err != nil {
+		return git.Status{}, err
+	}
+	status := git.Status{Dirty: r.dirty}
+	if r.detached {
+		return status, nil
+	}
+
+	status.Upstream = "origin/" + r.branch
+	commits := f.remotes[r.url].branches[r.branch]
+	head := r.head
+	if r.ahead > 0 {
+		head, status.Ahead = r.base, r.ahead
+	}
+	if i := slices.Index(commits, head); i >= 0 {
+		status.Behind = len(commits) - 1 - i
+	}
+	return status, nil
+}
+
+// Log returns the commits between from and to on the branch containing both. The commits only
+// have their SHA set, and the subject is "subject of <SHA>".
+func (f *Fake) Log(ctx context.Context, path string, from string, to string) ([]git.Commit, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record(ctx, "Log", path, from, to); err != nil {
+		return nil, err
+	}
+
+	r, err := f.repo(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range []*string{&from, &to} {
+		if *ref == "HEAD" {
+			*ref = r.head
+		} else if commit, ok := f.resolve(r.url, strings.TrimPrefix(*ref, "origin/")); ok {
+			*ref = commit
+		}
+	}
+	for _, commits := range f.remotes[r.url].branches {
+		start, end := slices.Index(commits, from), slices.Index(commits, to)
+		if start < 0 || end < 0 {
+			continue
+		}
+		var log []git.Commit
+		for i := end; i > start; i-- {
+			log = append(log, git.Commit{SHA: commits[i], Subject: "subject of " + commits[i]})
+		}
+		return log, nil
+	}
+	return nil, fmt.Errorf("failed to get log of %s", path)
+}
+
+func (f *Fake) repo(path string) (*repo, error) {
+	r, ok := f.repos[path]
+	if !ok {
+		return nil, errors.New(path + " is not a git repository")
+	}
+	return r, nil
+}
+
+// resolve resolves a commit, tag or branch of the remote repository at the URL to a commit.
+func (f *Fake) resolve(url string, ref string) (string, bool) {
+	r := f.remotes[url]
+	if commit, ok := r.tags[ref]; ok {
+		return commit, true
+	}
+	if commits, ok := r.branches[ref]; ok {
+		return commits[len(commits)-1], true
+	}
+	for _, commits := range r.branches {
+		if slices.Contains(commits, ref) {
+			return ref, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// CloneProgress is the progress git reports while cloning a repository.
+type CloneProgress struct {
+	// Phase is what git is doing (e.g. Receiving objects).
+	Phase   string
+	Percent int
+	// Current and Total are the number of objects done and to do in the phase.
+	Current int
+	Total   int
+}
+
+var progressRegexp = regexp.MustCompile(`^(?:remote: )?([A-Za-z ]+):\s+(\d+)% \((\d+)/(\d+)\)`)
+
+// parseProgress parses a progress line git writes to stderr (e.g. Receiving objects:  45%
+// (450/1000), 1.20 MiB | 2.00 MiB/s).
+func parseProgress(line string) (CloneProgress, bool) {
+	m := progressRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return CloneProgress{}, false
+	}
+	percent, _ := strconv.Atoi(m[2])
+	current, _ := strconv.Atoi(m[3])
+	total, _ := strconv.Atoi(m[4])
+	return CloneProgress{Phase: m[1], Percent: percent, Current: current, Total: total}, true
+}
+
+// progressWriter collects the output of git and calls fn for every progress line. git redraws
+// progress lines with a carriage return, so lines end with either a carriage return or a
+// newline.
+type progressWriter struct {
+	fn func(CloneProgress)
+
+	mu   sync.Mutex
+	out  bytes.Buffer
+	line []byte
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.out.Write(p)
+	for _, b := range p {
+		if b != '\r' && b != '\n' {
+			w.line = append(w.line, b)
+			continue
+		}
+		if progress, ok := parseProgress(string(w.line)); ok {
+			w.fn(progress)
+		}
+		w.line = w.line[:0]
+	}
+	return len(p), nil
+}
+
+// Bytes returns all the output written.
+func (w *progressWriter) Bytes() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Bytes()
+}
@@ -0,0 +1,94 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RefType is the kind of ref a plugin is pinned to.
+type RefType string
+
+const (
+	// RefDefault is the default branch of the repository.
+	RefDefault RefType = ""
+	// RefBranch is a branch. The plugin follows the branch when updated.
+	RefBranch RefType = "branch"
+	// RefTag is a tag. The plugin stays at the tag when updated.
+	RefTag RefType = "tag"
+	// RefCommit is a commit SHA. The plugin stays at the commit when updated.
+	RefCommit RefType = "commit"
+	// RefSemver is a semver constraint (e.g. ^1.2) resolved against the tags of the remote. The
+	// plugin moves to the newest tag satisfying the constraint when updated.
+	RefSemver RefType = "semver"
+)
+
+// Ref is the branch, tag, commit or semver constraint a plugin is pinned to.
+type Ref struct {
+	Type RefType
+	Name string
+}
+
+var (
+	commitPattern  = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	versionPattern = regexp.MustCompile(`^[vV]?\d+(\.\d+)*(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+)
+
+// ParseRef parses the ref a plugin is declared with (the part after #).
+//
+// The type of the ref is guessed from its name: 7 to 40 hex characters are a commit, versions
+// (e.g. v1.2.0) are a tag, names starting with an operator (^ ~ > < =) or containing a
+// wildcard or || are a semver constraint, and anything else is a branch. The guess can be
+// overridden by prefixing the name with branch:, tag:, commit: or semver:.
+func ParseRef(s string) Ref {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Ref{}
+	}
+
+	for _, t := range []RefType{RefBranch, RefTag, RefCommit, RefSemver} {
+		if name, ok := strings.CutPrefix(s, string(t)+":"); ok {
+			return Ref{Type: t, Name: name}
+		}
+	}
+
+	switch {
+	case commitPattern.MatchString(s):
+		return Ref{Type: RefCommit, Name: s}
+	case versionPattern.MatchString(s):
+		return Ref{Type: RefTag, Name: s}
+	case isConstraint(s):
+		return Ref{Type: RefSemver, Name: s}
+	default:
+		return Ref{Type: RefBranch, Name: s}
+	}
+}
+
+func isConstraint(s string) bool {
+	if strings.ContainsAny(s[:1], "^~><=!") || strings.Contains(s, "||") || strings.Contains(s, " ") {
+		return true
+	}
+	for _, part := range strings.Split(s, ".") {
+		if part == "x" || part == "X" || part == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the ref as it would be declared. The type is only prefixed when ParseRef would
+// not guess it from the name.
+func (r Ref) String() string {
+	if r.Name == "" {
+		return ""
+	}
+	if ParseRef(r.Name).Type == r.Type {
+		return r.Name
+	}
+	return string(r.Type) + ":" + r.Name
+}
+
+// IsPinned determines if the ref does not follow a branch, so the plugin is moved by checking
+// out the ref rather than pulling.
+func (r Ref) IsPinned() bool {
+	return r.Type == RefTag || r.Type == RefCommit || r.Type == RefSemver
+}
@@ -0,0 +1,43 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		name        string
+		ref         string
+		expectedRef git.Ref
+	}{
+		{name: "Empty", ref: "", expectedRef: git.Ref{}},
+		{name: "Branch", ref: "main", expectedRef: git.Ref{Type: git.RefBranch, Name: "main"}},
+		{name: "Branch with Slash", ref: "feature/v2", expectedRef: git.Ref{Type: git.RefBranch, Name: "feature/v2"}},
+		{name: "Tag", ref: "v1.2.0", expectedRef: git.Ref{Type: git.RefTag, Name: "v1.2.0"}},
+		{name: "Tag without Prefix", ref: "3.0", expectedRef: git.Ref{Type: git.RefTag, Name: "3.0"}},
+		{name: "Prerelease Tag", ref: "v2.0.0-rc.1", expectedRef: git.Ref{Type: git.RefTag, Name: "v2.0.0-rc.1"}},
+		{name: "Short Commit", ref: "25cb91f", expectedRef: git.Ref{Type: git.RefCommit, Name: "25cb91f"}},
+		{
+			name:        "Full Commit",
+			ref:         "25cb91f42d020f675bb0a2ce3fbd3a5d96119efa",
+			expectedRef: git.Ref{Type: git.RefCommit, Name: "25cb91f42d020f675bb0a2ce3fbd3a5d96119efa"},
+		},
+		{name: "Caret", ref: "^1.2", expectedRef: git.Ref{Type: git.RefSemver, Name: "^1.2"}},
+		{name: "Tilde", ref: "~1.2.3", expectedRef: git.Ref{Type: git.RefSemver, Name: "~1.2.3"}},
+		{name: "Wildcard", ref: "1.x", expectedRef: git.Ref{Type: git.RefSemver, Name: "1.x"}},
+		{name: "Range", ref: ">=1.0 <2.0", expectedRef: git.Ref{Type: git.RefSemver, Name: ">=1.0 <2.0"}},
+		{name: "Explicit Branch", ref: "branch:1.x", expectedRef: git.Ref{Type: git.RefBranch, Name: "1.x"}},
+		{name: "Explicit Tag", ref: "tag:latest", expectedRef: git.Ref{Type: git.RefTag, Name: "latest"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ref := git.ParseRef(test.ref)
+			assert.Equal(t, test.expectedRef, ref)
+			assert.Equal(t, test.ref, ref.String())
+		})
+	}
+}
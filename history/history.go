@@ -0,0 +1,107 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/state"
+)
+
+// FileName is the name of the history file in the state directory of a tmux conf file.
+const FileName = "history.json"
+
+// MaxUpdates is the number of updates kept in the history file. Older updates are dropped.
+const MaxUpdates = 20
+
+// Path returns the path of the history file of the plugins the tmux conf file installs to the
+// plugins directory.
+func Path(confPath string, pluginsPath string) string {
+	return filepath.Join(state.ConfigDir(confPath, pluginsPath), FileName)
+}
+
+// File is the content of the history file.
+type File struct {
+	// Updates are the updates that changed at least one plugin, oldest first.
+	Updates []Update `json:"updates"`
+}
+
+// Update is the changes an update made to the plugins.
+type Update struct {
+	Time    time.Time `json:"time"`
+	Changes []Change  `json:"changes"`
+}
+
+// Change is the commits a plugin moved through during an update.
+type Change struct {
+	Plugin string `json:"plugin"`
+	URL    string `json:"url,omitempty"`
+	// From and To are the commits the plugin was at before and after the update.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Commits are the commits between From and To, newest first. It is empty when the plugin
+	// moved backwards (e.g. to an older tag).
+	Commits []git.Commit `json:"commits"`
+	// Error is set when the commits could not be determined.
+	Error string `json:"error,omitempty"`
+}
+
+// Last returns the most recent update.
+func (f File) Last() (Update, bool) {
+	if len(f.Updates) == 0 {
+		return Update{}, false
+	}
+	return f.Updates[len(f.Updates)-1], true
+}
+
+// Read reads the history file at the path. If the file does not exist or is empty, an empty
+// history is returned.
+func Read(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return File{}, nil
+		}
+		return File{}, fmt.Errorf("failed to read history file: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return File{}, nil
+	}
+
+	var f File
+	if err = json.Unmarshal(data, &f); err != nil {
+		return File{}, fmt.Errorf("failed to parse history file "+path+": %w", err)
+	}
+	return f, nil
+}
+
+// Append adds the update to the history file at the path, creating the file if it does not
+// exist. Only the latest MaxUpdates updates are kept.
+func Append(path string, u Update) error {
+	f, err := Read(path)
+	if err != nil {
+		return err
+	}
+	f.Updates = append(f.Updates, u)
+	if len(f.Updates) > MaxUpdates {
+		f.Updates = f.Updates[len(f.Updates)-MaxUpdates:]
+	}
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode history file: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	if err = os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package history_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func update(n int) history.Update {
+	return history.Update{
+		Time: time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC),
+		Changes: []history.Change{{
+			Plugin:  "tmux-sensible",
+			URL:     "https://git::@github.com/tmux-plugins/tmux-sensible",
+			From:    "c" + strconv.Itoa(n-1),
+			To:      "c" + strconv.Itoa(n),
+			Commits: []git.Commit{{SHA: "c" + strconv.Itoa(n), Subject: "subject " + strconv.Itoa(n)}},
+		}},
+	}
+}
+
+func TestAppend(t *testing.T) {
+	tests := []struct {
+		name     string
+		updates  int
+		expected []history.Update
+	}{
+		{
+			name: "No Updates",
+		},
+		{
+			name:     "Updates",
+			updates:  2,
+			expected: []history.Update{update(1), update(2)},
+		},
+		{
+			name:    "Drops Oldest",
+			updates: history.MaxUpdates + 2,
+			expected: func() []history.Update {
+				var updates []history.Update
+				for n := 3; n <= history.MaxUpdates+2; n++ {
+					updates = append(updates, update(n))
+				}
+				return updates
+			}(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state", history.FileName)
+			for n := 1; n <= test.updates; n++ {
+				require.NoError(t, history.Append(path, update(n)))
+			}
+
+			f, err := history.Read(path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, f.Updates)
+			last, ok := f.Last()
+			if test.updates == 0 {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, update(test.updates), last)
+		})
+	}
+}
+
+func TestRead_Files(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{
+			name:    "Empty",
+			content: "",
+		},
+		{
+			name:    "Whitespace",
+			content: "\n",
+		},
+		{
+			name:        "Corrupt",
+			content:     `{"updates": [`,
+			expectedErr: "failed to parse history file",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), history.FileName)
+			require.NoError(t, os.WriteFile(path, []byte(test.content), 0o644))
+
+			f, err := history.Read(path)
+			if test.expectedErr != "" {
+				require.ErrorContains(t, err, test.expectedErr)
+				// a corrupt history is not replaced
+				require.Error(t, history.Append(path, update(1)))
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, f.Updates)
+			require.NoError(t, history.Append(path, update(1)))
+			f, err = history.Read(path)
+			require.NoError(t, err)
+			assert.Equal(t, []history.Update{update(1)}, f.Updates)
+		})
+	}
+}
+
+func TestPath(t *testing.T) {
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	confPath := filepath.Join(dir, "tmux.conf")
+	pluginsPath := filepath.Join(dir, "plugins")
+	path := history.Path(confPath, pluginsPath)
+
+	tests := []struct {
+		name        string
+		confPath    string
+		pluginsPath string
+		same        bool
+	}{
+		{name: "Same", confPath: confPath, pluginsPath: pluginsPath, same: true},
+		{name: "Relative", confPath: "tmux.conf", pluginsPath: "./plugins", same: true},
+		{name: "Other Conf File", confPath: filepath.Join(dir, "other.conf"), pluginsPath: pluginsPath},
+		{name: "Other Plugins Dir", confPath: confPath, pluginsPath: filepath.Join(dir, "other")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := history.Path(test.confPath, test.pluginsPath)
+			assert.Equal(t, history.FileName, filepath.Base(actual))
+			assert.Equal(t, filepath.Join(stateHome, "gtpm", "configs"), filepath.Dir(filepath.Dir(actual)))
+			if test.same {
+				assert.Equal(t, path, actual)
+			} else {
+				assert.NotEqual(t, path, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// FileName is the name of the lock file written next to the tmux conf file.
+const FileName = "gtpm.lock"
+
+// Path returns the path of the lock file for the tmux conf file. It is next to the tmux conf file,
+// except for the system tmux conf file, as users cannot write next to it. Its lock file is in
+// $XDG_CONFIG_HOME/tmux (or ~/.config/tmux) instead.
+func Path(confPath string) string {
+	if filepath.Clean(confPath) == tmux.SystemConfigPath {
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(os.Getenv("HOME"), ".config")
+		}
+		return filepath.Join(configHome, "tmux", FileName)
+	}
+	return filepath.Join(filepath.Dir(confPath), FileName)
+}
+
+// File is the content of the lock file.
+type File struct {
+	Plugins []Plugin `json:"plugins"`
+}
+
+// Plugin is the locked state of an installed plugin.
+type Plugin struct {
+	// Name is the name of the directory the plugin is installed to.
+	Name string `json:"name"`
+	// URL is the URL the plugin was cloned from.
+	URL string `json:"url"`
+	// Ref is the branch, tag, commit or semver constraint declared for the plugin. Empty means
+	// the default branch.
+	Ref string `json:"ref,omitempty"`
+	// Commit is the commit SHA the plugin is locked to.
+	Commit string `json:"commit"`
+}
+
+// Get returns the locked plugin with the name.
+func (f File) Get(name string) (Plugin, bool) {
+	for _, p := range f.Plugins {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Plugin{}, false
+}
+
+// Set replaces the locked plugin with the same name, or adds it when there is none.
+func (f *File) Set(plugin Plugin) {
+	for i, p := range f.Plugins {
+		if p.Name == plugin.Name {
+			f.Plugins[i] = plugin
+			return
+		}
+	}
+	f.Plugins = append(f.Plugins, plugin)
+}
+
+// ErrNotFound is returned when the lock file does not exist.
+var ErrNotFound = errors.New("lock file not found")
+
+// Read reads the lock file at the path. If the file does not exist, ErrNotFound is returned.
+func Read(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return File{}, ErrNotFound
+		}
+		return File{}, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	var f File
+	if err = json.Unmarshal(data, &f); err != nil {
+		return File{}, fmt.Errorf("failed to parse lock file "+path+": %w", err)
+	}
+	return f, nil
+}
+
+// Write writes the lock file to the path, replacing any existing file.
+func Write(path string, f File) error {
+	if f.Plugins == nil {
+		f.Plugins = []Plugin{}
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create lock file directory: %w", err)
+	}
+	if err = os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package lock_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     lock.File
+		expected string
+	}{
+		{
+			name: "Plugins",
+			file: lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: "https://git::@github.com/tmux-plugins/tmux-sensible", Commit: "s1"},
+				{Name: "tmux-yank", URL: "https://git::@github.com/tmux-plugins/tmux-yank", Ref: "v2.3.0", Commit: "y1"},
+			}},
+			expected: `{
+  "plugins": [
+    {
+      "name": "tmux-sensible",
+      "url": "https://git::@github.com/tmux-plugins/tmux-sensible",
+      "commit": "s1"
+    },
+    {
+      "name": "tmux-yank",
+      "url": "https://git::@github.com/tmux-plugins/tmux-yank",
+      "ref": "v2.3.0",
+      "commit": "y1"
+    }
+  ]
+}
+`,
+		},
+		{
+			name:     "No Plugins",
+			file:     lock.File{},
+			expected: "{\n  \"plugins\": []\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), lock.FileName)
+			require.NoError(t, lock.Write(path, test.file))
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(data))
+
+			actual, err := lock.Read(path)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, test.file.Plugins, actual.Plugins)
+		})
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := lock.Read(filepath.Join(dir, lock.FileName))
+	assert.ErrorIs(t, err, lock.ErrNotFound)
+
+	path := filepath.Join(dir, "invalid.lock")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	_, err = lock.Read(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse lock file "+path)
+}
+
+func TestFile_Set(t *testing.T) {
+	f := lock.File{Plugins: []lock.Plugin{{Name: "a", Commit: "a1"}, {Name: "b", Commit: "b1"}}}
+	f.Set(lock.Plugin{Name: "a", Commit: "a2"})
+	f.Set(lock.Plugin{Name: "c", Commit: "c1"})
+	assert.Equal(t, []lock.Plugin{{Name: "a", Commit: "a2"}, {Name: "b", Commit: "b1"}, {Name: "c", Commit: "c1"}}, f.Plugins)
+
+	p, ok := f.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, "b1", p.Commit)
+	_, ok = f.Get("d")
+	assert.False(t, ok)
+}
+
+func TestPath(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	assert.Equal(t, filepath.Join("/home", "me", ".config", "tmux", lock.FileName), lock.Path("/home/me/.config/tmux/tmux.conf"))
+	assert.Equal(t, filepath.Join("/home", "me", lock.FileName), lock.Path("/home/me/.tmux.conf"))
+	// users cannot write next to the system tmux conf file
+	assert.Equal(t, filepath.Join("/home", "me", ".config", "tmux", lock.FileName), lock.Path("/etc/tmux.conf"))
+	t.Setenv("XDG_CONFIG_HOME", "/home/me/config")
+	assert.Equal(t, filepath.Join("/home", "me", "config", "tmux", lock.FileName), lock.Path("/etc/tmux.conf"))
+}
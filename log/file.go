@@ -0,0 +1,118 @@
+package log
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Piszmog/gtpm/state"
+)
+
+// FileName is the name of the log file in the state directory.
+const FileName = "gtpm.log"
+
+// MaxFileSize is the size in bytes the log file can grow to before it is rotated.
+const MaxFileSize = 1 << 20
+
+// MaxBackups is the number of rotated log files that are kept (e.g. gtpm.log.1).
+const MaxBackups = 3
+
+// FilePath returns the path of the log file in the state directory.
+func FilePath() string {
+	return filepath.Join(state.Dir(), FileName)
+}
+
+// OpenFile opens the log file at the path for appending, creating it if it does not exist. When
+// the file has grown past MaxFileSize, it is rotated first.
+func OpenFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() >= MaxFileSize {
+		if err = rotate(path); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	return f, nil
+}
+
+// rotate moves the log file at the path to path.1, shifting the older backups up and dropping
+// the oldest one.
+func rotate(path string) error {
+	for i := MaxBackups - 1; i > 0; i-- {
+		src := path + "." + strconv.Itoa(i)
+		if err := os.Rename(src, path+"."+strconv.Itoa(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	return nil
+}
+
+// NewFileHandler creates the handler writing to the log file. Every record has the ID of the run,
+// so the records of a single run can be found.
+func NewFileHandler(w io.Writer, level Level, runID string) slog.Handler {
+	// the file is read after the fact, so the results of a run are always recorded
+	l := min(level.ToSlog(), slog.LevelInfo)
+	return slog.NewTextHandler(w, &slog.HandlerOptions{Level: l}).
+		WithAttrs([]slog.Attr{slog.String(runIDKey, runID)})
+}
+
+const runIDKey = "run"
+
+// NewRunID creates a random ID for a run.
+func NewRunID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// PrintFile writes the log file at the path to w. When last is set, only the records of the
+// last run are written.
+func PrintFile(w io.Writer, path string, last bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no log file at %s, nothing has been logged yet", path)
+		}
+		return fmt.Errorf("failed to read log file: %w", err)
+	}
+	if !last {
+		_, err = w.Write(data)
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	id := runID(lines[len(lines)-1])
+	for _, line := range lines {
+		if runID(line) != id {
+			continue
+		}
+		if _, err = fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runID returns the ID of the run a line of the log file was written by.
+func runID(line string) string {
+	_, after, ok := strings.Cut(line, " "+runIDKey+"=")
+	if !ok {
+		return ""
+	}
+	id, _, _ := strings.Cut(after, " ")
+	return id
+}
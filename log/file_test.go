@@ -0,0 +1,97 @@
+package log_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Piszmog/gtpm/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenFile_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gtpm", log.FileName)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	for i := 1; i <= log.MaxBackups; i++ {
+		require.NoError(t, os.WriteFile(path+"."+strconv.Itoa(i), []byte("backup"), 0o644))
+	}
+	require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("a"), log.MaxFileSize), 0o644))
+
+	f, err := log.OpenFile(path)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+	info, err = os.Stat(path + ".1")
+	require.NoError(t, err)
+	assert.EqualValues(t, log.MaxFileSize, info.Size())
+	assert.NoFileExists(t, path+"."+strconv.Itoa(log.MaxBackups+1))
+}
+
+func TestPrintFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), log.FileName)
+	for _, id := range []string{"first", "second"} {
+		f, err := log.OpenFile(path)
+		require.NoError(t, err)
+		logger := slog.New(log.NewFileHandler(f, log.LevelInfo, id))
+		logger.Info("started command")
+		logger.Debug("not recorded")
+		logger.Info("finished command")
+		require.NoError(t, f.Close())
+	}
+
+	tests := []struct {
+		name          string
+		last          bool
+		expectedLines int
+		expectedRuns  []string
+	}{
+		{
+			name:          "All",
+			expectedLines: 4,
+			expectedRuns:  []string{"run=first", "run=second"},
+		},
+		{
+			name:          "Last",
+			last:          true,
+			expectedLines: 2,
+			expectedRuns:  []string{"run=second"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			require.NoError(t, log.PrintFile(&out, path, test.last))
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			assert.Len(t, lines, test.expectedLines)
+			for _, run := range test.expectedRuns {
+				assert.Contains(t, out.String(), run)
+			}
+			assert.NotContains(t, out.String(), "not recorded")
+		})
+	}
+}
+
+func TestMultiHandler(t *testing.T) {
+	var info, debug bytes.Buffer
+	logger := slog.New(log.NewMultiHandler(
+		slog.NewTextHandler(&info, &slog.HandlerOptions{Level: slog.LevelInfo}),
+		slog.NewTextHandler(&debug, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)).With("plugin", "tmux-sensible")
+
+	logger.Debug("cloning plugin")
+	logger.Info("installed plugin")
+
+	assert.Equal(t, 1, strings.Count(info.String(), "\n"))
+	assert.Equal(t, 2, strings.Count(debug.String(), "\n"))
+	assert.Contains(t, info.String(), "plugin=tmux-sensible")
+	assert.Contains(t, debug.String(), `msg="cloning plugin" plugin=tmux-sensible`)
+}
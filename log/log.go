@@ -5,16 +5,20 @@ import (
 	"os"
 )
 
-// New creates a new logger with the given level and output.
-func New(level Level, output Output) *slog.Logger {
+// New creates a new logger with the given level and output. Logs are written to stderr so they
+// do not mix with the output of commands, and to the extra handlers (e.g. the log file).
+func New(level Level, output Output, handlers ...slog.Handler) *slog.Logger {
 	var h slog.Handler
 	switch output {
 	case OutputJSON:
-		h = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level.ToSlog()})
+		h = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level.ToSlog()})
 	case OutputText:
-		h = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level.ToSlog()})
+		h = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level.ToSlog()})
 	default:
-		h = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level.ToSlog()})
+		h = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level.ToSlog()})
+	}
+	if len(handlers) > 0 {
+		h = NewMultiHandler(append([]slog.Handler{h}, handlers...)...)
 	}
 	return slog.New(h)
 }
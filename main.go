@@ -1,34 +1,123 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/lock"
 	"github.com/Piszmog/gtpm/log"
 	"github.com/Piszmog/gtpm/run"
+	"github.com/Piszmog/gtpm/tmux"
 	"github.com/urfave/cli/v2"
 )
 
+var (
+	// start is when the command started running.
+	start time.Time
+	// logFile is the log file every run is recorded in. It is nil when the log file could not be
+	// opened.
+	logFile *os.File
+	// fileLogger only writes to the log file.
+	fileLogger *slog.Logger
+	// cancelDeadline cancels the context with the deadline of --deadline.
+	cancelDeadline context.CancelFunc
+)
+
+var jobsFlag = &cli.IntFlag{
+	Name:    "jobs",
+	Aliases: []string{"j"},
+	Value:   4,
+	Usage:   "Number of plugins to process at the same time",
+}
+
 func main() {
 	var logger *slog.Logger
 	app := &cli.App{
 		Usage: "TPM Plugin Manager",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:  "level",
-				Value: "info",
-				Usage: "Change the log level (e.g. debug, warn, info)",
+				Name:    "level",
+				Value:   string(log.LevelInfo),
+				Usage:   "Change the log level (e.g. debug, warn, info)",
+				EnvVars: []string{"LOG_LEVEL"},
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   string(log.OutputText),
+				Usage:   "Change the output (e.g. text, json). With json, the logs are JSON and the result of the command is written to stdout as a JSON object",
+				EnvVars: []string{"LOG_OUTPUT"},
+			},
+			&cli.StringFlag{
+				Name:      "config",
+				Usage:     "Path of the tmux conf file, instead of $TMUX_CONF, the file the running tmux server loaded or the default locations",
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:      "plugins-dir",
+				Usage:     "Directory plugins are installed to, instead of @gtpm-plugin-dir, $TMUX_PLUGIN_MANAGER_PATH or the default location",
+				TakesFile: true,
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Value: 5 * time.Minute,
+				Usage: "How long acting on a single plugin (e.g. cloning or sourcing it) can take, 0 for no limit",
+			},
+			&cli.DurationFlag{
+				Name:  "deadline",
+				Usage: "How long the whole command can take, 0 for no limit",
+			},
+			&cli.BoolFlag{
+				Name:  "progress",
+				Usage: "Show the progress of install and update in a tmux popup, or in the output of run-shell when popups are not supported (used by the key bindings)",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the actions install, update, restore, rollback, clean, add, remove and migrate would perform without performing them",
 			},
 		},
+		Before: func(ctx *cli.Context) error {
+			start = time.Now()
+			if deadline := ctx.Duration("deadline"); deadline > 0 {
+				ctx.Context, cancelDeadline = context.WithTimeout(ctx.Context, deadline)
+			}
+			level := log.ToLevel(ctx.String("level"))
+			var handlers []slog.Handler
+			// viewing the logs is not recorded, so --last shows the run before it
+			if ctx.Args().First() != "logs" {
+				f, err := log.OpenFile(log.FilePath())
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				} else {
+					logFile = f
+					fileLogger = slog.New(log.NewFileHandler(f, level, log.NewRunID()))
+					fileLogger.Info("started command", "args", os.Args[1:])
+					handlers = append(handlers, fileLogger.Handler())
+				}
+			}
+			logger = log.New(level, log.ToOutput(ctx.String("output")), handlers...)
+			return nil
+		},
+		// exit codes are handled after the run is recorded in the log file
+		ExitErrHandler: func(*cli.Context, error) {},
 		Commands: []*cli.Command{
 			{
 				Name:    "clean",
 				Aliases: []string{"c"},
 				Usage:   "Clean Plugins",
 				Action: func(ctx *cli.Context) error {
-					logger = log.New(log.Level(ctx.String("level")), log.OutputText)
-					return run.Clean(ctx.Context, logger)
+					summary, err := run.Clean(ctx.Context, logger, newOptions(ctx))
+					recordResults(summary)
+					return printSummary(ctx, summary, err)
 				},
 			},
 			{
@@ -41,20 +130,281 @@ func main() {
 						Aliases: []string{"p"},
 						Usage:   "Plugin to update",
 					},
+					jobsFlag,
+					&cli.BoolFlag{
+						Name:  "since-last",
+						Usage: "Show the changes of the last update that changed a plugin instead of updating",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   string(run.FormatTable),
+						Usage:   "Format of the changelog (e.g. table, plain, json)",
+					},
 				},
 				Action: func(ctx *cli.Context) error {
-					logger = log.New(log.Level(ctx.String("level")), log.OutputText)
-					plugins := ctx.StringSlice("plugin")
-					return run.Update(ctx.Context, logger, plugins)
+					format := run.Format(ctx.String("format"))
+					if ctx.Bool("since-last") {
+						changelog, err := run.LastChangelog(ctx.Context, logger, newOptions(ctx))
+						if isJSON(ctx) {
+							return writeReport(ctx, run.Summary{}, changelog, err)
+						}
+						if err != nil {
+							return err
+						}
+						return changelog.Print(os.Stdout, format)
+					}
+
+					opts := newOptions(ctx)
+					progress, popup, err := startProgress(ctx, logger, "Updating plugins")
+					if popup {
+						return err
+					}
+					if progress != nil {
+						opts.Observer = &progressObserver{progress: progress}
+					}
+					summary, err := run.Update(ctx.Context, logger, opts, ctx.StringSlice("plugin"))
+					recordResults(summary)
+					if progress != nil {
+						return finishProgress(progress, summary, err)
+					}
+					if isJSON(ctx) {
+						return writeReport(ctx, summary, nil, err)
+					}
+					if format == run.FormatJSON && !ctx.Bool("dry-run") && len(summary.Results) > 0 {
+						// only the changelog is printed so the output is valid JSON
+						return errors.Join(err, summary.Changelog.Print(os.Stdout, format))
+					}
+					err = printSummary(ctx, summary, err)
+					if len(summary.Changelog.Changes) > 0 {
+						fmt.Println()
+						err = errors.Join(err, summary.Changelog.Print(os.Stdout, format))
+					}
+					return err
 				},
 			},
 			{
 				Name:    "install",
 				Aliases: []string{"i"},
 				Usage:   "Install Plugins",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "ignore-lock",
+						Usage: "Install the latest commit of plugins instead of the commit in " + lock.FileName,
+					},
+					jobsFlag,
+				},
+				Action: func(ctx *cli.Context) error {
+					opts := newOptions(ctx)
+					opts.IgnoreLock = ctx.Bool("ignore-lock")
+					progress, popup, err := startProgress(ctx, logger, "Installing plugins")
+					if popup {
+						return err
+					}
+					if progress != nil {
+						opts.Observer = &progressObserver{progress: progress}
+					}
+					summary, err := run.Install(ctx.Context, logger, opts)
+					recordResults(summary)
+					if progress != nil {
+						return finishProgress(progress, summary, err)
+					}
+					return printSummary(ctx, summary, err)
+				},
+			},
+			{
+				Name:      "add",
+				Usage:     "Add plugins to the tmux conf file and install them",
+				ArgsUsage: "<owner>/<repo>[#ref]...",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "ignore-lock",
+						Usage: "Install the latest commit of plugins instead of the commit in " + lock.FileName,
+					},
+					jobsFlag,
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() == 0 {
+						return errors.New("expected a plugin to add (e.g. gtpm add tmux-plugins/tmux-yank)")
+					}
+					opts := newOptions(ctx)
+					opts.IgnoreLock = ctx.Bool("ignore-lock")
+					summary, err := run.Add(ctx.Context, logger, opts, ctx.Args().Slice())
+					recordResults(summary)
+					return printSummary(ctx, summary, err)
+				},
+			},
+			{
+				Name:      "remove",
+				Aliases:   []string{"rm"},
+				Usage:     "Remove plugins from the tmux conf file and clean them",
+				ArgsUsage: "<owner>/<repo>...",
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() == 0 {
+						return errors.New("expected a plugin to remove (e.g. gtpm remove tmux-plugins/tmux-yank)")
+					}
+					summary, err := run.Remove(ctx.Context, logger, newOptions(ctx), ctx.Args().Slice())
+					recordResults(summary)
+					return printSummary(ctx, summary, err)
+				},
+			},
+			{
+				Name:  "rollback",
+				Usage: "Reset plugins to the commits they were at before the last update",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    "plugin",
+						Aliases: []string{"p"},
+						Usage:   "Plugin to roll back",
+					},
+					&cli.IntFlag{
+						Name:  "steps",
+						Value: 1,
+						Usage: "Number of updates to roll back",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					opts := newOptions(ctx)
+					summary, err := run.Rollback(ctx.Context, logger, opts, ctx.StringSlice("plugin"), ctx.Int("steps"))
+					recordResults(summary)
+					return printSummary(ctx, summary, err)
+				},
+			},
+			{
+				Name:  "outdated",
+				Usage: "Check which plugins have updates available without applying them",
+				Flags: []cli.Flag{
+					jobsFlag,
+					&cli.BoolFlag{
+						Name:  "cached",
+						Usage: "Use the result of the last check if it is younger than --max-age instead of fetching",
+					},
+					&cli.DurationFlag{
+						Name:  "max-age",
+						Value: time.Hour,
+						Usage: "How long the result of a check is used by --cached",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   string(run.FormatTable),
+						Usage:   "Format of the output (e.g. table, plain, json)",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					var maxAge time.Duration
+					if ctx.Bool("cached") {
+						maxAge = ctx.Duration("max-age")
+					}
+					report, err := run.Outdated(ctx.Context, logger, newOptions(ctx), maxAge)
+					if isJSON(ctx) {
+						if err == nil && report.Count() > 0 {
+							err = cli.Exit("", run.ExitCodeUpdatesAvailable)
+						}
+						return writeReport(ctx, run.Summary{}, report, err)
+					}
+					if err != nil {
+						return err
+					}
+					if err = report.Print(os.Stdout, run.Format(ctx.String("format"))); err != nil {
+						return err
+					}
+					if report.Count() > 0 {
+						return cli.Exit("", run.ExitCodeUpdatesAvailable)
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "restore",
+				Usage: "Restore Plugins to the commits in " + lock.FileName,
+				Action: func(ctx *cli.Context) error {
+					summary, err := run.Restore(ctx.Context, logger, newOptions(ctx))
+					recordResults(summary)
+					return printSummary(ctx, summary, err)
+				},
+			},
+			{
+				Name:    "list",
+				Aliases: []string{"l", "status"},
+				Usage:   "List Plugins and their status",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   string(run.FormatTable),
+						Usage:   "Format of the output (e.g. table, plain, json)",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					status, err := run.List(ctx.Context, logger, newOptions(ctx))
+					if isJSON(ctx) {
+						return writeReport(ctx, run.Summary{}, status, err)
+					}
+					if err != nil {
+						return err
+					}
+					return status.Print(os.Stdout, run.Format(ctx.String("format")))
+				},
+			},
+			{
+				Name:  "doctor",
+				Usage: "Check that tmux, git and gtpm are set up correctly and explain how to fix any problem",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   string(run.FormatTable),
+						Usage:   "Format of the output (e.g. table, plain, json)",
+					},
+				},
 				Action: func(ctx *cli.Context) error {
-					logger = log.New(log.Level(ctx.String("level")), log.OutputText)
-					return run.Install(ctx.Context, logger)
+					diagnosis, err := run.Doctor(ctx.Context, logger, newOptions(ctx))
+					if err == nil && diagnosis.Failed() > 0 {
+						err = cli.Exit(strconv.Itoa(diagnosis.Failed())+" checks failed", run.ExitCodeError)
+					}
+					if isJSON(ctx) {
+						return writeReport(ctx, run.Summary{}, diagnosis, err)
+					}
+					if printErr := diagnosis.Print(os.Stdout, run.Format(ctx.String("format"))); printErr != nil {
+						return errors.Join(err, printErr)
+					}
+					return err
+				},
+			},
+			{
+				Name:  "migrate",
+				Usage: "Migrate from tpm by rewriting the tmux conf file and adopting the plugins tpm installed",
+				Action: func(ctx *cli.Context) error {
+					migration, err := run.Migrate(ctx.Context, logger, newOptions(ctx))
+					if err == nil && len(migration.Problems) > 0 {
+						err = cli.Exit(strconv.Itoa(len(migration.Problems))+" problems have to be fixed by hand", run.ExitCodeError)
+					}
+					if isJSON(ctx) {
+						return writeReport(ctx, run.Summary{}, migration, err)
+					}
+					if printErr := migration.Print(os.Stdout); printErr != nil {
+						return errors.Join(err, printErr)
+					}
+					return err
+				},
+			},
+			{
+				Name:  "logs",
+				Usage: "Show the log file every run is recorded in",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "last",
+						Usage: "Only show the logs of the last run",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if isJSON(ctx) {
+						var out strings.Builder
+						err := log.PrintFile(&out, log.FilePath(), ctx.Bool("last"))
+						return writeReport(ctx, run.Summary{}, strings.Split(strings.TrimRight(out.String(), "\n"), "\n"), err)
+					}
+					return log.PrintFile(os.Stdout, log.FilePath(), ctx.Bool("last"))
 				},
 			},
 			{
@@ -62,18 +412,217 @@ func main() {
 				Aliases: []string{"s"},
 				Usage:   "Source Plugins",
 				Action: func(ctx *cli.Context) error {
-					logger = log.New(log.Level(ctx.String("level")), log.OutputText)
-					return run.Source(ctx.Context, logger)
+					err := run.Source(ctx.Context, logger, newOptions(ctx))
+					if isJSON(ctx) {
+						return writeReport(ctx, run.Summary{}, nil, err)
+					}
+					return err
 				},
 			},
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
+	// the first SIGINT or SIGTERM stops the command gracefully, a second one kills it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := app.RunContext(ctx, os.Args)
+	stop()
+	if cancelDeadline != nil {
+		cancelDeadline()
+	}
+	code := run.ExitCode(err)
+	var exitErr cli.ExitCoder
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
 		if logger != nil {
 			logger.Error("failed to run application", "error", err)
 		} else {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	if fileLogger != nil {
+		attrs := []any{"duration", time.Since(start), "exit_code", code}
+		if err != nil && exitErr == nil {
+			attrs = append(attrs, "error", err)
+		}
+		fileLogger.Info("finished command", attrs...)
+		logFile.Close()
+	}
+	if path := os.Getenv(tmux.PopupStatusEnvVar); path != "" {
+		// the gtpm that opened the popup exits with the code
+		_ = os.WriteFile(path, []byte(strconv.Itoa(code)), 0o600)
+	}
+	os.Exit(code)
+}
+
+// recordResults writes the result of every plugin to the log file.
+func recordResults(summary run.Summary) {
+	if fileLogger == nil {
+		return
+	}
+	for i, r := range summary.Results {
+		attrs := []any{"plugin", r.Plugin, "action", summary.Plan.Actions[i].Kind, "outcome", r.Outcome, "duration", r.Duration}
+		if r.From != r.To {
+			attrs = append(attrs, "from", r.From, "to", r.To)
+		}
+		if r.Err != nil {
+			attrs = append(attrs, "error", r.Err)
+		}
+		fileLogger.Info("plugin result", attrs...)
+	}
+}
+
+func printSummary(ctx *cli.Context, summary run.Summary, err error) error {
+	if isJSON(ctx) {
+		return writeReport(ctx, summary, nil, err)
+	}
+	if ctx.Bool("dry-run") {
+		if printErr := summary.Plan.Print(os.Stdout); printErr != nil {
+			return errors.Join(err, printErr)
+		}
+		return err
+	}
+	if len(summary.Results) > 0 {
+		if printErr := summary.Print(os.Stdout); printErr != nil {
+			return errors.Join(err, printErr)
+		}
+	}
+	return err
+}
+
+// isJSON returns whether the result of the command is written as a JSON object.
+func isJSON(ctx *cli.Context) bool {
+	return log.ToOutput(ctx.String("output")) == log.OutputJSON
+}
+
+// writeReport writes the result of the command to stdout as a JSON object. The data is the
+// output specific to the command. The error is returned so it is still logged and sets the exit
+// code.
+func writeReport(ctx *cli.Context, summary run.Summary, data any, err error) error {
+	report := run.NewReport(ctx.Command.Name, summary, time.Since(start), err)
+	if data != nil {
+		report.Data = data
+	}
+	var exitErr cli.ExitCoder
+	if errors.As(err, &exitErr) {
+		// the outcome follows the exit code, except for outdated finding updates, which is not an
+		// error
+		report.ExitCode = exitErr.ExitCode()
+		if report.ExitCode == 0 || report.ExitCode == run.ExitCodeUpdatesAvailable {
+			report.Outcome = run.OutcomeSucceeded
+			report.Error = ""
 		}
 	}
+	if writeErr := report.Write(os.Stdout); writeErr != nil {
+		return errors.Join(err, writeErr)
+	}
+	return err
+}
+
+// startProgress shows the progress of the command for tmux when --progress is set. When running
+// inside tmux and not yet in a popup, the command is run again in a popup and popup is returned
+// so the caller stops, with an error carrying the exit code of the command when it failed. When
+// popups are not supported, the progress is written for the output of run-shell instead.
+func startProgress(ctx *cli.Context, logger *slog.Logger, title string) (progress *tmux.Progress, popup bool, err error) {
+	if !ctx.Bool("progress") || ctx.Bool("dry-run") || isJSON(ctx) {
+		return nil, false, nil
+	}
+	inPopup := os.Getenv(tmux.PopupEnvVar) != ""
+	if !inPopup && os.Getenv("TMUX") != "" {
+		code, err := openPopup(ctx.Context)
+		if err == nil {
+			if code != 0 {
+				// run-shell shows the output of the key binding in the pane
+				logger.Error("command failed in the popup, see the log file", "command", ctx.Command.Name, "exit_code", code)
+				return nil, true, cli.Exit("", code)
+			}
+			return nil, true, nil
+		}
+		logger.Debug("failed to open popup, showing progress in run-shell output", "error", err)
+	}
+	return tmux.NewProgress(os.Stdout, title, inPopup), false, nil
+}
+
+// openPopup runs gtpm again with the same arguments in a tmux popup and returns its exit code.
+// The popup writes its exit code to a file, as tmux does not pass it on.
+func openPopup(ctx context.Context) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to find gtpm executable: %w", err)
+	}
+	statusFile, err := os.CreateTemp("", "gtpm-popup-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create popup status file: %w", err)
+	}
+	statusFile.Close()
+	defer os.Remove(statusFile.Name())
+
+	args := []string{tmux.PopupEnvVar + "=1", tmux.PopupStatusEnvVar + "=" + tmux.ShellQuote(statusFile.Name()), tmux.ShellQuote(executable)}
+	for _, arg := range os.Args[1:] {
+		args = append(args, tmux.ShellQuote(arg))
+	}
+	if err = tmux.NewExecClient().DisplayPopup(ctx, " gtpm ", strings.Join(args, " ")); err != nil {
+		return 0, err
+	}
+
+	// the file is empty when the popup was closed before gtpm finished
+	status, _ := os.ReadFile(statusFile.Name())
+	code, err := strconv.Atoi(strings.TrimSpace(string(status)))
+	if err != nil {
+		return run.ExitCodeError, nil
+	}
+	return code, nil
+}
+
+// progressObserver shows the status of every plugin in the progress.
+type progressObserver struct {
+	run.NopObserver
+	progress *tmux.Progress
+}
+
+func (o *progressObserver) PluginStarted(plugin string, action run.ActionKind) {
+	if action != run.ActionSkip {
+		o.progress.Start(plugin, string(action))
+	}
+}
+
+func (o *progressObserver) CloneProgress(plugin string, progress git.CloneProgress) {
+	o.progress.Update(plugin, fmt.Sprintf("clone... %s %d%%", strings.ToLower(progress.Phase), progress.Percent))
+}
+
+func (o *progressObserver) PluginDone(plugin string, _ run.ActionKind, result run.Result) {
+	o.progress.Done(plugin, string(result.Outcome), result.Detail())
+}
+
+func (o *progressObserver) PluginFailed(plugin string, _ run.ActionKind, err error) {
+	o.progress.Done(plugin, string(run.OutcomeFailed), err.Error())
+}
+
+// finishProgress shows the totals of the summary and waits for the progress to be closed.
+func finishProgress(progress *tmux.Progress, summary run.Summary, err error) error {
+	totals := summary.Totals()
+	if len(summary.Results) == 0 && err != nil {
+		totals = err.Error()
+	}
+	if finishErr := progress.Finish(totals); finishErr != nil {
+		return errors.Join(err, finishErr)
+	}
+	return err
+}
+
+// newOptions creates the options of the command from the flags.
+func newOptions(ctx *cli.Context) run.Options {
+	return run.Options{
+		Jobs:       ctx.Int("jobs"),
+		DryRun:     ctx.Bool("dry-run"),
+		Timeout:    ctx.Duration("timeout"),
+		ConfigPath: ctx.String("config"),
+		PluginsDir: ctx.String("plugins-dir"),
+	}
 }
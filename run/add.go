@@ -0,0 +1,88 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// Add declares the plugins (e.g. owner/repo#ref) in the tmux conf file and installs them. The
+// declarations are inserted above the run 'gtpm source' line, keeping every other line of the
+// file as is. Only the added plugins are installed, and plugins that are installed already are
+// left as they are.
+//
+// On a dry run, the tmux conf file is not changed and the plan to clone the plugins is returned.
+func Add(ctx context.Context, logger *slog.Logger, opts Options, plugins []string) (Summary, error) {
+	logger.Debug("adding plugins", "plugins", plugins)
+
+	client := opts.git(logger)
+
+	logger.Debug("checking if git is install")
+	if !client.IsInstalled(ctx) {
+		return Summary{}, fmt.Errorf("%w to add plugins", ErrGitNotInstalled)
+	}
+
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		return Summary{}, err
+	}
+	if err = tmux.CheckEditable(confPath); err != nil {
+		return Summary{}, err
+	}
+	configuredPlugins, err := getPlugins(logger, confPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	declarations := make([]string, 0, len(plugins))
+	var added []tmux.Plugin
+	for _, p := range plugins {
+		p = strings.TrimSpace(p)
+		// relative paths in the tmux conf file are resolved from its directory, so a path relative
+		// to the working directory is declared as an absolute path
+		if strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") {
+			source, ref, found := strings.Cut(p, "#")
+			abs, err := filepath.Abs(source)
+			if err != nil {
+				return Summary{}, &PluginError{Plugin: p, Err: err}
+			}
+			p = abs
+			if found {
+				p += "#" + ref
+			}
+		}
+		plugin, err := tmux.ParsePlugin(p)
+		if err != nil {
+			return Summary{}, &PluginError{Plugin: p, Err: err}
+		}
+		// plugins are installed to a directory named after the repository, so it has to be unique
+		sameDir := func(c tmux.Plugin) bool { return c.Repo == plugin.Repo }
+		if slices.ContainsFunc(configuredPlugins, sameDir) || slices.ContainsFunc(added, sameDir) {
+			return Summary{}, &PluginError{Plugin: p, Err: ErrAlreadyConfigured}
+		}
+		declarations = append(declarations, p)
+		added = append(added, plugin)
+	}
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	if !opts.DryRun {
+		line, err := tmux.AddPlugins(confPath, declarations)
+		if err != nil {
+			return Summary{}, fmt.Errorf("failed to add plugins to %s: %w", confPath, err)
+		}
+		logger.Debug("added plugins", "plugins", declarations, "path", confPath, "line", line)
+	}
+
+	summary, err := installPlugins(ctx, logger, client, opts, confPath, pluginsPath, added)
+	logger.Debug("completed adding plugins")
+	return summary, err
+}
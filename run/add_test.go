@@ -0,0 +1,131 @@
+package run_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/Piszmog/gtpm/run"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name            string
+		plugins         []string
+		sensibleMissing bool
+		dryRun          bool
+		expectedConf    string
+		expectedActions []run.ActionKind
+		expectedErrIs   error
+	}{
+		{
+			name:    "Add",
+			plugins: []string{"tmux-plugins/tmux-yank", " tmux-plugins/tmux-resurrect#main "},
+			expectedConf: `# plugins
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-resurrect#main'
+
+run 'gtpm source'
+`,
+			expectedActions: []run.ActionKind{run.ActionClone, run.ActionClone},
+		},
+		{
+			name:            "Only Added",
+			plugins:         []string{"tmux-plugins/tmux-yank", "tmux-plugins/tmux-resurrect#main"},
+			sensibleMissing: true,
+			expectedConf:    "# plugins\nset -g @plugin 'tmux-plugins/tmux-sensible'\nset -g @plugin 'tmux-plugins/tmux-yank'\nset -g @plugin 'tmux-plugins/tmux-resurrect#main'\n\nrun 'gtpm source'\n",
+			expectedActions: []run.ActionKind{run.ActionClone, run.ActionClone},
+		},
+		{
+			name:            "Dry Run",
+			plugins:         []string{"tmux-plugins/tmux-yank"},
+			dryRun:          true,
+			expectedActions: []run.ActionKind{run.ActionClone},
+		},
+		{
+			name:          "Already Configured",
+			plugins:       []string{"someone/tmux-sensible"},
+			expectedErrIs: run.ErrAlreadyConfigured,
+		},
+		{
+			name:          "Added Twice",
+			plugins:       []string{"tmux-plugins/tmux-yank", "tmux-plugins/tmux-yank#v2"},
+			expectedErrIs: run.ErrAlreadyConfigured,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := "# plugins\nset -g @plugin 'tmux-plugins/tmux-sensible'\n\nrun 'gtpm source'\n"
+			dir := setupConfig(t, conf)
+			pluginsPath := filepath.Join(dir, "plugins")
+			gitClient := newFake()
+			gitClient.AddRemote(resurrectURL, "main", "r1")
+			if !test.sensibleMissing {
+				require.NoError(t, gitClient.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+			}
+
+			summary, err := run.Add(context.Background(), logger, run.Options{Git: gitClient, DryRun: test.dryRun}, test.plugins)
+			actual, readErr := os.ReadFile(filepath.Join(dir, "tmux.conf"))
+			require.NoError(t, readErr)
+			if test.expectedErrIs != nil {
+				require.ErrorIs(t, err, test.expectedErrIs)
+				assert.Equal(t, conf, string(actual))
+				return
+			}
+			require.NoError(t, err)
+
+			var actions []run.ActionKind
+			for _, a := range summary.Plan.Actions {
+				actions = append(actions, a.Kind)
+			}
+			assert.Equal(t, test.expectedActions, actions)
+
+			if test.dryRun {
+				assert.Equal(t, conf, string(actual))
+				assert.NoDirExists(t, filepath.Join(pluginsPath, "tmux-yank"))
+				return
+			}
+			assert.Equal(t, test.expectedConf, string(actual))
+			assert.DirExists(t, filepath.Join(pluginsPath, "tmux-yank"))
+			assert.DirExists(t, filepath.Join(pluginsPath, "tmux-resurrect"))
+			f, err := lock.Read(lock.Path(filepath.Join(dir, "tmux.conf")))
+			require.NoError(t, err)
+			_, ok := f.Get("tmux-yank")
+			assert.True(t, ok)
+			// only the added plugins are installed
+			if test.sensibleMissing {
+				assert.NoDirExists(t, filepath.Join(pluginsPath, "tmux-sensible"))
+			}
+			_, ok = f.Get("tmux-sensible")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestAdd_RelativePath(t *testing.T) {
+	dir := setupConfig(t, "run 'gtpm source'\n")
+	work := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(work))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	pluginURL := filepath.Join(work, "tmux-local")
+	gitClient := newFake()
+	gitClient.AddRemote(pluginURL, "main", "l1")
+
+	summary, err := run.Add(context.Background(), logger, run.Options{Git: gitClient}, []string{"./tmux-local#main"})
+	require.NoError(t, err)
+	require.Len(t, summary.Plan.Actions, 1)
+	assert.Equal(t, pluginURL, summary.Plan.Actions[0].URL)
+
+	actual, err := os.ReadFile(filepath.Join(dir, "tmux.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "set -g @plugin '"+pluginURL+"#main'\nrun 'gtpm source'\n", string(actual))
+}
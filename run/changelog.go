@@ -0,0 +1,129 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/history"
+)
+
+// Changelog is the commits every plugin moved through during an update.
+type Changelog history.Update
+
+// LastChangelog returns the changelog of the last update that changed a plugin of the tmux conf
+// file.
+func LastChangelog(ctx context.Context, logger *slog.Logger, opts Options) (Changelog, error) {
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		return Changelog{}, err
+	}
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Changelog{}, err
+	}
+
+	path := history.Path(confPath, pluginsPath)
+	logger.Debug("reading history file", "path", path)
+	f, err := history.Read(path)
+	if err != nil {
+		return Changelog{}, err
+	}
+	last, ok := f.Last()
+	if !ok {
+		return Changelog{}, errors.New("no update has changed a plugin yet")
+	}
+	return Changelog(last), nil
+}
+
+// changelog returns the commits of every plugin the summary moved to a different commit.
+func changelog(ctx context.Context, logger *slog.Logger, client git.Client, summary Summary) Changelog {
+	c := Changelog{Time: time.Now().UTC(), Changes: []history.Change{}}
+	for i, r := range summary.Results {
+		if r.Outcome != OutcomeSucceeded || r.From == r.To {
+			continue
+		}
+		a := summary.Plan.Actions[i]
+		change := history.Change{Plugin: r.Plugin, URL: a.URL, From: r.From, To: r.To, Commits: []git.Commit{}}
+		commits, err := client.Log(ctx, a.Path, r.From, r.To)
+		if err != nil {
+			logger.Debug("failed to get commits of plugin", "plugin", r.Plugin, "error", err)
+			change.Error = err.Error()
+		} else if commits != nil {
+			change.Commits = commits
+		}
+		c.Changes = append(c.Changes, change)
+	}
+	return c
+}
+
+// record appends the changelog to the history file at the path, unless no plugin changed.
+func (c Changelog) record(logger *slog.Logger, path string) error {
+	if len(c.Changes) == 0 {
+		return nil
+	}
+	logger.Debug("writing history file", "path", path, "plugins", len(c.Changes))
+	return history.Append(path, history.Update(c))
+}
+
+// Print writes the changelog in the format to w.
+func (c Changelog) Print(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	case FormatPlain:
+		for _, change := range c.Changes {
+			for _, commit := range change.Commits {
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", change.Plugin, commit.SHA, commit.Subject); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case FormatTable:
+		if len(c.Changes) == 0 {
+			_, err := fmt.Fprintln(w, "no plugins changed")
+			return err
+		}
+		for i, change := range c.Changes {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s %s -> %s (%s)\n", change.Plugin, shortCommit(change.From), shortCommit(change.To), commitCount(len(change.Commits)))
+			if change.Error != "" {
+				fmt.Fprintf(w, "  %s\n", change.Error)
+			}
+			for _, commit := range change.Commits {
+				line := "  " + shortCommit(commit.SHA)
+				if commit.Subject != "" {
+					line += " " + commit.Subject
+				}
+				if commit.Author != "" {
+					line += " (" + commit.Author + ", " + commit.Date.Format(time.DateOnly) + ")"
+				}
+				if _, err := fmt.Fprintln(w, line); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+}
+
+func commitCount(n int) string {
+	if n == 1 {
+		return "1 commit"
+	}
+	return strconv.Itoa(n) + " commits"
+}
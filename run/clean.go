@@ -6,68 +6,60 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
-
-	"github.com/Piszmog/gtpm/tmux"
 )
 
-func Clean(ctx context.Context, logger *slog.Logger) error {
+// Clean removes the plugin directories that do not belong to a plugin in the tmux conf file. If
+// the tmux conf file has no plugins, the whole plugins directory is removed.
+func Clean(ctx context.Context, logger *slog.Logger, opts Options) (Summary, error) {
 	logger.Debug("cleaning plugins")
-	confPath, err := tmux.GetConfigFilePath(logger)
+	confPath, err := getConfigPath(ctx, logger, opts)
 	if err != nil {
-		return err
+		return Summary{}, err
 	}
-	logger.Debug("found tmux conf file", "path", confPath)
 
-	rootDir := filepath.Dir(confPath)
-	pluginsPath := filepath.Join(rootDir, "plugins")
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Summary{}, err
+	}
 	if _, err = os.Stat(pluginsPath); err != nil {
 		if os.IsNotExist(err) {
 			logger.Debug("plugins directory does not exist, nothing to do", "path", pluginsPath)
-			return nil
+			return Summary{}, nil
 		} else {
-			return fmt.Errorf("failed to check if plugins directory exists: %w", err)
+			return Summary{}, fmt.Errorf("failed to check if plugins directory exists: %w", err)
 		}
 	}
 
 	logger.Debug("finding plugins from conf file", "path", confPath)
-	plugins, err := tmux.GetPlugins(confPath)
+	plugins, err := getPlugins(logger, confPath)
 	if err != nil {
-		return err
+		return Summary{}, err
 	}
 	logger.Debug("found current plugins", "path", confPath, "plugins", plugins)
 
+	client := opts.git(logger)
+
+	var plan Plan
 	if len(plugins) == 0 {
 		logger.Debug("conf has no plugins so removing plugins directory", "dir", pluginsPath)
-		if err = os.RemoveAll(pluginsPath); err != nil {
-			return fmt.Errorf("failed to remove plugins directory: %w", err)
+		plan.Actions = append(plan.Actions, Action{Kind: ActionRemove, Path: pluginsPath})
+	} else {
+		orphaned, err := orphanedPlugins(pluginsPath, plugins)
+		if err != nil {
+			return Summary{}, err
+		}
+		for _, name := range orphaned {
+			plan.Actions = append(plan.Actions, Action{Kind: ActionRemove, Plugin: name, Path: filepath.Join(pluginsPath, name)})
 		}
-		return nil
 	}
 
-	files, err := os.ReadDir(pluginsPath)
-	if err != nil {
-		return fmt.Errorf("failed to read plugin directory: %w", err)
+	if opts.DryRun {
+		logger.Debug("dry run, not cleaning plugins")
+		return Summary{Plan: plan}, nil
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			found := false
-			for _, p := range plugins {
-				if strings.Contains(p, file.Name()) {
-					found = true
-					break
-				}
-			}
-			if !found {
-				path := filepath.Join(pluginsPath, file.Name())
-				if err = os.RemoveAll(path); err != nil {
-					return fmt.Errorf("failed to clean plugin "+file.Name()+": %w", err)
-				}
-			}
-		}
-	}
+	summary := plan.execute(ctx, logger, client, opts)
 	logger.Debug("finished cleaning plugins")
 
-	return nil
+	return summary, summary.Err()
 }
@@ -0,0 +1,343 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// CheckStatus is the outcome of a check performed by Doctor.
+type CheckStatus string
+
+const (
+	// CheckOK is when nothing is wrong.
+	CheckOK CheckStatus = "ok"
+	// CheckWarn is when something may not work as expected.
+	CheckWarn CheckStatus = "warn"
+	// CheckFail is when something does not work.
+	CheckFail CheckStatus = "fail"
+)
+
+// Check is a single check performed by Doctor.
+type Check struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	// Detail is what was found.
+	Detail string `json:"detail"`
+	// Fix explains how to fix a check that did not pass.
+	Fix string `json:"fix,omitempty"`
+}
+
+// Diagnosis is the result of every check performed by Doctor.
+type Diagnosis struct {
+	Checks []Check `json:"checks"`
+}
+
+// Failed returns the number of checks that failed.
+func (d Diagnosis) Failed() int {
+	var n int
+	for _, c := range d.Checks {
+		if c.Status == CheckFail {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *Diagnosis) add(name string, status CheckStatus, detail string, fix string) {
+	d.Checks = append(d.Checks, Check{Name: name, Status: status, Detail: detail, Fix: fix})
+}
+
+// Doctor checks that tmux, git and gtpm are set up to manage the plugins in the tmux conf file
+// and explains how to fix any problem found. A check that does not pass is not an error, only
+// failing to perform the checks is.
+func Doctor(ctx context.Context, logger *slog.Logger, opts Options) (Diagnosis, error) {
+	logger.Debug("diagnosing setup")
+	var d Diagnosis
+	client := opts.tmux()
+
+	if version, err := client.Version(ctx); err != nil {
+		logger.Debug("failed to get version of tmux", "error", err)
+		d.add("tmux", CheckFail, "tmux is not installed", "install tmux and add it to your PATH")
+	} else if major, minor, ok := parseTmuxVersion(version); ok && (major < 3 || major == 3 && minor < 2) {
+		// popups and the config_files format were added in 3.2
+		d.add("tmux", CheckWarn, "tmux "+version, "upgrade to tmux 3.2 or newer to show progress in a popup")
+	} else {
+		d.add("tmux", CheckOK, "tmux "+version, "")
+	}
+
+	if version, err := opts.git(logger).Version(ctx); err != nil {
+		logger.Debug("failed to get version of git", "error", err)
+		d.add("git", CheckFail, "git is not installed", "install git and add it to your PATH")
+	} else {
+		d.add("git", CheckOK, "git "+version, "")
+	}
+
+	checkPath(ctx, logger, opts, &d)
+
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return d, ctx.Err()
+		}
+		d.add("config", CheckFail, err.Error(), "create ~/.tmux.conf or pass --config")
+		return d, nil
+	}
+	d.add("config", CheckOK, confPath, "")
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return d, err
+	}
+	checkPluginsDir(pluginsPath, &d)
+
+	if err = checkSourceLine(confPath, &d); err != nil {
+		return d, err
+	}
+
+	plugins, err := getPlugins(logger, confPath)
+	if err != nil {
+		d.add("plugins", CheckFail, err.Error(), "fix the @plugin declaration in the tmux conf file")
+		return d, nil
+	}
+	if err = checkPlugins(pluginsPath, plugins, &d); err != nil {
+		return d, err
+	}
+
+	logger.Debug("completed diagnosing setup", "checks", len(d.Checks), "failed", d.Failed())
+	return d, nil
+}
+
+// parseTmuxVersion parses the major and minor version of tmux (e.g. 3.3a or next-3.5).
+func parseTmuxVersion(version string) (int, int, bool) {
+	version = strings.TrimPrefix(version, "next-")
+	var major, minor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &major, &minor); err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// checkPath checks that gtpm and tmux are on the PATH run-shell uses, which is the global
+// environment of the tmux server. Without them, the key bindings and run 'gtpm source' fail with
+// 127.
+func checkPath(ctx context.Context, logger *slog.Logger, opts Options, d *Diagnosis) {
+	pathEnv := os.Getenv("PATH")
+	source := "the PATH of this shell"
+	if server := opts.server(); server != nil {
+		value, isSet, err := server.ShowEnvironment(ctx, "PATH")
+		if err != nil {
+			logger.Debug("failed to get PATH of tmux server", "error", err)
+		} else if isSet {
+			pathEnv = value
+			source = "the PATH of the tmux server"
+		}
+	}
+
+	var missing []string
+	for _, name := range []string{"gtpm", "tmux"} {
+		if p, ok := findExecutable(pathEnv, name); ok {
+			logger.Debug("found executable", "name", name, "path", p)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		d.add("path", CheckFail, strings.Join(missing, " and ")+" not on "+source,
+			`add set-environment -g PATH "$PATH:<directory of tmux>:<directory of gtpm>" before run 'gtpm source'`)
+	case opts.server() == nil:
+		d.add("path", CheckWarn, "gtpm and tmux on "+source+", tmux is not running to check its PATH", "run gtpm doctor inside tmux")
+	default:
+		d.add("path", CheckOK, "gtpm and tmux on "+source, "")
+	}
+}
+
+// findExecutable returns the path of the executable with the name in the directories of the
+// PATH.
+func findExecutable(pathEnv string, name string) (string, bool) {
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// checkPluginsDir checks that plugins can be installed to the plugins directory. A directory
+// that does not exist yet is created by install.
+func checkPluginsDir(pluginsPath string, d *Diagnosis) {
+	dir := pluginsPath
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	if !tmux.HasPermissions(dir) {
+		d.add("plugin directory", CheckFail, "no write permissions to "+dir, "change the owner of "+dir+" or set @gtpm-plugin-dir to a writable directory")
+		return
+	}
+	if dir != pluginsPath {
+		d.add("plugin directory", CheckOK, pluginsPath+" (created by install)", "")
+		return
+	}
+	d.add("plugin directory", CheckOK, pluginsPath, "")
+}
+
+// checkSourceLine checks that run 'gtpm source' is the last command of the tmux conf file, so the
+// options of the plugins are set before they are sourced.
+func checkSourceLine(confPath string, d *Diagnosis) error {
+	f, err := os.Open(confPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	config, err := tmux.Parse(f)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", confPath, err)
+	}
+
+	// a run 'gtpm source' in a %if block is last when the block is the last statement
+	sourceLine, tpmLine, sourceNodeLine, lastNodeLine := 0, 0, 0, 0
+	for _, node := range config.Nodes {
+		if _, ok := node.(tmux.Assignment); ok {
+			continue
+		}
+		lastNodeLine, _ = node.Lines()
+		if cmd, ok := tmux.FindPluginManager(node, "gtpm"); ok {
+			sourceLine, sourceNodeLine = cmd.StartLine, lastNodeLine
+		}
+		if cmd, ok := tmux.FindPluginManager(node, "tpm"); ok {
+			tpmLine = cmd.StartLine
+		}
+	}
+
+	line := func(n int) string {
+		return fmt.Sprintf("%s:%d", confPath, n)
+	}
+	switch {
+	case sourceLine == 0 && tpmLine != 0:
+		d.add("source", CheckFail, "tpm is run at "+line(tpmLine)+" instead of gtpm", "run gtpm migrate")
+	case sourceLine == 0:
+		d.add("source", CheckFail, "run 'gtpm source' is missing", "add run 'gtpm source' at the end of "+confPath)
+	case sourceNodeLine != lastNodeLine:
+		d.add("source", CheckWarn, "run 'gtpm source' at "+line(sourceLine)+" is not the last line", "move it to the end of "+confPath+" so plugin options are set before plugins are sourced")
+	default:
+		d.add("source", CheckOK, "run 'gtpm source' at "+line(sourceLine), "")
+	}
+	return nil
+}
+
+// checkPlugins checks that every configured plugin is installed and has a single executable
+// *.tmux file, and that there are no orphaned plugins.
+func checkPlugins(pluginsPath string, plugins []tmux.Plugin, d *Diagnosis) error {
+	if len(plugins) == 0 {
+		d.add("plugins", CheckWarn, "no plugins are configured", "add set -g @plugin '<owner>/<repo>' to the tmux conf file")
+	}
+	for _, plugin := range plugins {
+		name := "plugin " + plugin.Repo
+		path := filepath.Join(pluginsPath, plugin.Repo)
+		if _, err := os.Stat(path); err != nil {
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("failed to check if plugin exists: %w", err)
+			}
+			d.add(name, CheckWarn, "not installed", "run gtpm install")
+			continue
+		}
+		if plugin.Repo == "tpm" {
+			d.add(name, CheckOK, "installed, not sourced", "")
+			continue
+		}
+		entrypoint, err := findEntrypoint(path)
+		switch {
+		case errors.Is(err, ErrNoEntrypoint):
+			d.add(name, CheckFail, "no *.tmux file in "+path, "check that "+plugin.URL+" is a tmux plugin")
+			continue
+		case errors.Is(err, ErrMultipleEntrypoints):
+			d.add(name, CheckFail, "multiple *.tmux files in "+path, "remove the *.tmux files that are not the plugin")
+			continue
+		case err != nil:
+			return err
+		}
+		entrypointPath := filepath.Join(path, entrypoint)
+		info, err := os.Stat(entrypointPath)
+		if err != nil {
+			return fmt.Errorf("failed to check entrypoint of plugin: %w", err)
+		}
+		if info.Mode()&0o111 == 0 {
+			d.add(name, CheckFail, entrypoint+" is not executable", "run chmod +x "+entrypointPath)
+			continue
+		}
+		d.add(name, CheckOK, "installed, sources "+entrypoint, "")
+	}
+
+	if _, err := os.Stat(pluginsPath); os.IsNotExist(err) {
+		return nil
+	}
+	orphaned, err := orphanedPlugins(pluginsPath, plugins)
+	if err != nil {
+		return err
+	}
+	if len(orphaned) > 0 {
+		d.add("orphaned", CheckWarn, strings.Join(orphaned, ", ")+" installed but not configured", "run gtpm clean")
+	}
+	return nil
+}
+
+// Print writes the diagnosis in the format to w. The fixes of the checks that did not pass are
+// listed after the table.
+func (d Diagnosis) Print(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case FormatPlain:
+		for _, c := range d.Checks {
+			if _, err := fmt.Fprintln(w, string(c.Status)+"\t"+c.Name+"\t"+c.Detail+"\t"+c.Fix); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "STATUS\tCHECK\tDETAIL")
+		for _, c := range d.Checks {
+			fmt.Fprintln(tw, string(c.Status)+"\t"+c.Name+"\t"+c.Detail)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		var fixes []string
+		for _, c := range d.Checks {
+			if c.Status != CheckOK && c.Fix != "" {
+				fixes = append(fixes, "  "+c.Name+": "+c.Fix)
+			}
+		}
+		if len(fixes) == 0 {
+			return nil
+		}
+		_, err := fmt.Fprintln(w, "\nTo fix:\n"+strings.Join(fixes, "\n"))
+		return err
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+}
@@ -0,0 +1,151 @@
+package run_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Piszmog/gtpm/run"
+	"github.com/Piszmog/gtpm/tmux/tmuxtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctor(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     string
+		setup    func(t *testing.T, pluginsPath string, tmuxClient *tmuxtest.Fake)
+		expected map[string]run.CheckStatus
+	}{
+		{
+			name: "Healthy",
+			conf: `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+run 'gtpm source'
+`,
+			setup: func(t *testing.T, pluginsPath string, tmuxClient *tmuxtest.Fake) {
+				writeExecutable(t, filepath.Join(pluginsPath, "tmux-sensible", "sensible.tmux"))
+			},
+			expected: map[string]run.CheckStatus{
+				"tmux":                 run.CheckOK,
+				"git":                  run.CheckOK,
+				"path":                 run.CheckOK,
+				"config":               run.CheckOK,
+				"plugin directory":     run.CheckOK,
+				"source":               run.CheckOK,
+				"plugin tmux-sensible": run.CheckOK,
+			},
+		},
+		{
+			name: "Problems",
+			conf: `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+run '~/.tmux/plugins/tpm/tpm'
+`,
+			setup: func(t *testing.T, pluginsPath string, tmuxClient *tmuxtest.Fake) {
+				tmuxClient.TmuxVersion = "3.1c"
+				tmuxClient.Environment["PATH"] = filepath.Join(t.TempDir(), "bin")
+				sensible := filepath.Join(pluginsPath, "tmux-sensible")
+				require.NoError(t, os.MkdirAll(sensible, os.ModePerm))
+				require.NoError(t, os.WriteFile(filepath.Join(sensible, "sensible.tmux"), nil, 0o644))
+				writeExecutable(t, filepath.Join(pluginsPath, "tmux-yank", "a.tmux"))
+				writeExecutable(t, filepath.Join(pluginsPath, "tmux-yank", "b.tmux"))
+				require.NoError(t, os.MkdirAll(filepath.Join(pluginsPath, "tmux-old"), os.ModePerm))
+			},
+			expected: map[string]run.CheckStatus{
+				"tmux":                  run.CheckWarn,
+				"git":                   run.CheckOK,
+				"path":                  run.CheckFail,
+				"config":                run.CheckOK,
+				"plugin directory":      run.CheckOK,
+				"source":                run.CheckFail,
+				"plugin tmux-sensible":  run.CheckFail,
+				"plugin tmux-yank":      run.CheckFail,
+				"plugin tmux-resurrect": run.CheckWarn,
+				"orphaned":              run.CheckWarn,
+			},
+		},
+		{
+			name: "Source In Conditional",
+			conf: `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'someone/notpm'
+%if "#{==:#{host},work}"
+run 'gtpm source'
+%endif
+`,
+			setup: func(t *testing.T, pluginsPath string, tmuxClient *tmuxtest.Fake) {
+				writeExecutable(t, filepath.Join(pluginsPath, "tmux-sensible", "sensible.tmux"))
+				// only a directory named tpm is tpm
+				require.NoError(t, os.MkdirAll(filepath.Join(pluginsPath, "notpm"), os.ModePerm))
+			},
+			expected: map[string]run.CheckStatus{
+				"tmux":                 run.CheckOK,
+				"git":                  run.CheckOK,
+				"path":                 run.CheckOK,
+				"config":               run.CheckOK,
+				"plugin directory":     run.CheckOK,
+				"source":               run.CheckOK,
+				"plugin tmux-sensible": run.CheckOK,
+				"plugin notpm":         run.CheckFail,
+			},
+		},
+		{
+			name: "Source Not Last",
+			conf: `
+run -b 'gtpm source'
+set -g status-left ''
+`,
+			expected: map[string]run.CheckStatus{
+				"tmux":             run.CheckOK,
+				"git":              run.CheckOK,
+				"path":             run.CheckOK,
+				"config":           run.CheckOK,
+				"plugin directory": run.CheckOK,
+				"source":           run.CheckWarn,
+				"plugins":          run.CheckWarn,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, test.conf)
+			pluginsPath := filepath.Join(dir, "plugins")
+			bin := t.TempDir()
+			writeExecutable(t, filepath.Join(bin, "gtpm"))
+			writeExecutable(t, filepath.Join(bin, "tmux"))
+			tmuxClient := tmuxtest.NewFake()
+			tmuxClient.Environment["PATH"] = bin
+			if test.setup != nil {
+				test.setup(t, pluginsPath, tmuxClient)
+			}
+
+			diagnosis, err := run.Doctor(context.Background(), logger, run.Options{Git: newFake(), Tmux: tmuxClient})
+			require.NoError(t, err)
+			actual := make(map[string]run.CheckStatus)
+			for _, c := range diagnosis.Checks {
+				actual[c.Name] = c.Status
+				if c.Status != run.CheckOK {
+					assert.NotEmpty(t, c.Fix, c.Name)
+				}
+			}
+			assert.Equal(t, test.expected, actual)
+
+			var out bytes.Buffer
+			require.NoError(t, diagnosis.Print(&out, run.FormatTable))
+			assert.Contains(t, out.String(), "STATUS  CHECK")
+		})
+	}
+}
+
+func writeExecutable(t *testing.T, path string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755))
+}
@@ -0,0 +1,92 @@
+package run
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Piszmog/gtpm/git"
+)
+
+var (
+	// ErrGitNotInstalled is when git is not available. It is wrapped with what git is required
+	// for.
+	ErrGitNotInstalled = errors.New("git is required")
+	// ErrNotInstalled is when a plugin has no directory in the plugins directory.
+	ErrNotInstalled = errors.New("not installed")
+	// ErrNotConfigured is when a plugin is not declared in the tmux conf file.
+	ErrNotConfigured = errors.New("not configured in the tmux conf file")
+	// ErrAlreadyConfigured is when a plugin added to the tmux conf file is declared in it already.
+	ErrAlreadyConfigured = errors.New("already configured in the tmux conf file")
+	// ErrSameDirectory is when two different plugins are installed to the same directory (e.g.
+	// a/foo and b/foo).
+	ErrSameDirectory = errors.New("installs to the same directory as another plugin")
+	// ErrNoEntrypoint is when a plugin has no *.tmux file to source.
+	ErrNoEntrypoint = errors.New("no *.tmux file to source")
+	// ErrMultipleEntrypoints is when a plugin has more than one *.tmux file, so it is not known
+	// which to source.
+	ErrMultipleEntrypoints = errors.New("multiple *.tmux files to source")
+)
+
+// PluginError is an error of a plugin.
+type PluginError struct {
+	Plugin string
+	Err    error
+}
+
+func (e *PluginError) Error() string {
+	return "plugin " + e.Plugin + ": " + e.Err.Error()
+}
+
+func (e *PluginError) Unwrap() error {
+	return e.Err
+}
+
+// Exit codes of the process. Any error not listed exits with ExitCodeError.
+const (
+	ExitCodeError               = 1
+	ExitCodeGitNotInstalled     = 3
+	ExitCodeNotInstalled        = 4
+	ExitCodeNotConfigured       = 5
+	ExitCodeAuthFailed          = 6
+	ExitCodeRemoteNotFound      = 7
+	ExitCodeConflict            = 8
+	ExitCodeNoEntrypoint        = 9
+	ExitCodeMultipleEntrypoints = 10
+	ExitCodeTimeout             = 11
+	// ExitCodeUpdatesAvailable is the exit code of outdated when a plugin has an update
+	// available. It is not returned by ExitCode, as it is not an error.
+	ExitCodeUpdatesAvailable = 100
+	// ExitCodeCanceled is the exit code of a process interrupted with Ctrl-C.
+	ExitCodeCanceled = 130
+)
+
+// ExitCode returns the exit code of the process for the error. When several plugins failed, the
+// code of the first matching error in the order of the exit codes is returned.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrGitNotInstalled):
+		return ExitCodeGitNotInstalled
+	case errors.Is(err, ErrNotInstalled):
+		return ExitCodeNotInstalled
+	case errors.Is(err, ErrNotConfigured):
+		return ExitCodeNotConfigured
+	case errors.Is(err, git.ErrAuthFailed):
+		return ExitCodeAuthFailed
+	case errors.Is(err, git.ErrRemoteNotFound):
+		return ExitCodeRemoteNotFound
+	case errors.Is(err, git.ErrConflict):
+		return ExitCodeConflict
+	case errors.Is(err, ErrNoEntrypoint):
+		return ExitCodeNoEntrypoint
+	case errors.Is(err, ErrMultipleEntrypoints):
+		return ExitCodeMultipleEntrypoints
+	case errors.Is(err, context.DeadlineExceeded):
+		return ExitCodeTimeout
+	case errors.Is(err, context.Canceled):
+		return ExitCodeCanceled
+	default:
+		return ExitCodeError
+	}
+}
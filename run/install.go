@@ -5,88 +5,117 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/lock"
 	"github.com/Piszmog/gtpm/tmux"
 )
 
-func Install(ctx context.Context, logger *slog.Logger) error {
+// Install clones every plugin in the tmux conf file that is not installed yet. Unless the lock
+// file is ignored, plugins in the lock file are checked out at their locked commit. The cloned
+// plugins are recorded in the lock file afterwards, keeping the entries of the other plugins.
+//
+// A failure to install one plugin does not stop the others from being installed. The outcome
+// of every plugin is returned in the summary, and the error contains all the plugins that failed.
+func Install(ctx context.Context, logger *slog.Logger, opts Options) (Summary, error) {
 	logger.Debug("installing plugins")
 
+	client := opts.git(logger)
+
 	logger.Debug("checking if git is install")
-	if !git.IsInstalled(ctx) {
-		return errors.New("git is required to install plugins")
+	if !client.IsInstalled(ctx) {
+		return Summary{}, fmt.Errorf("%w to install plugins", ErrGitNotInstalled)
 	}
 
-	confPath, err := tmux.GetConfigFilePath(logger)
+	confPath, err := getConfigPath(ctx, logger, opts)
 	if err != nil {
-		return err
-	}
-	logger.Debug("found tmux conf file", "path", confPath)
-
-	rootPath := filepath.Dir(confPath)
-	if !tmux.HasPermissions(rootPath) {
-		return errors.New("do not have write permissions to " + rootPath)
+		return Summary{}, err
 	}
 
-	pluginsPath := filepath.Join(rootPath, "plugins")
-	if err = tmux.CreatePluginsDir(pluginsPath); err != nil {
-		return err
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Summary{}, err
 	}
 
-	plugins, err := tmux.GetPlugins(confPath)
+	plugins, err := getPlugins(logger, confPath)
 	if err != nil {
-		return err
+		return Summary{}, err
 	}
 	logger.Debug("plugins to install", "plugins", plugins)
 
 	if len(plugins) == 0 {
 		logger.Debug("nothing to install")
-		return nil
+		return Summary{}, nil
 	}
 
-	files, err := os.ReadDir(pluginsPath)
-	if err != nil {
-		return fmt.Errorf("failed to read plugin directory: %w", err)
-	}
+	summary, err := installPlugins(ctx, logger, client, opts, confPath, pluginsPath, plugins)
+	logger.Debug("completed installing plugins")
+	return summary, err
+}
 
-	pluginsToInstall := []string{}
-	for _, p := range plugins {
-		pluginInstalled := false
-		for _, file := range files {
-			if file.IsDir() && strings.Contains(p, file.Name()) {
-				logger.Debug("plugin already installed", "plugin", p, "path", pluginsPath)
-				pluginInstalled = true
-				break
-			}
+// installPlugins clones the plugins that are not installed yet, at their locked commit unless the
+// lock file is ignored, and records the cloned plugins in the lock file.
+func installPlugins(ctx context.Context, logger *slog.Logger, client git.Client, opts Options, confPath string, pluginsPath string, plugins []tmux.Plugin) (Summary, error) {
+	if !opts.DryRun {
+		if err := tmux.CreatePluginsDir(pluginsPath); err != nil {
+			return Summary{}, err
 		}
-		if !pluginInstalled {
-			pluginsToInstall = append(pluginsToInstall, p)
+		if !tmux.HasPermissions(pluginsPath) {
+			return Summary{}, errors.New("do not have write permissions to " + pluginsPath)
 		}
 	}
 
-	if len(pluginsToInstall) == 0 {
-		logger.Debug("no plugins to install")
-		return nil
+	files, err := readPluginsDir(pluginsPath)
+	if err != nil {
+		return Summary{}, err
 	}
 
-	logger.Debug("need to install plugins", "plugins", pluginsToInstall)
+	var lockFile lock.File
+	if opts.IgnoreLock {
+		logger.Debug("ignoring lock file")
+	} else if lockFile, err = readLock(logger, confPath); err != nil {
+		return Summary{}, err
+	}
 
-	for _, p := range pluginsToInstall {
-		plugin, err := tmux.ParsePlugin(p)
-		if err != nil {
-			return err
+	var plan Plan
+	for _, plugin := range plugins {
+		path := filepath.Join(pluginsPath, plugin.Repo)
+		if isInstalled(plugin, files) {
+			logger.Debug("plugin already installed", "plugin", plugin.Repo, "path", pluginsPath)
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Plugin: plugin.Repo, Path: path, Reason: "already installed"})
+			continue
 		}
-		logger.Debug("cloning plugin", "plugin", p)
-		err = git.Clone(logger, "https://git::@github.com/"+plugin.Owner+"/"+plugin.Repo, plugin.Branch, filepath.Join(pluginsPath, plugin.Repo))
-		if err != nil {
-			return err
+		commit, _ := lockedCommit(lockFile, plugin)
+		plan.Actions = append(plan.Actions, Action{
+			Kind:   ActionClone,
+			Plugin: plugin.Repo,
+			URL:    plugin.URL,
+			Ref:    plugin.Ref.String(),
+			Commit: commit,
+			Path:   path,
+		})
+	}
+
+	if opts.DryRun {
+		logger.Debug("dry run, not installing plugins")
+		return Summary{Plan: plan}, nil
+	}
+
+	summary := plan.execute(ctx, logger, client, opts)
+
+	// only the plugins that were cloned are locked, so the commits other plugins are locked to
+	// (e.g. in a lock file shared between machines) are kept. The plan has an action for every
+	// plugin, in the same order.
+	var cloned []tmux.Plugin
+	for i, a := range plan.Actions {
+		if a.Kind == ActionClone && summary.Results[i].Outcome == OutcomeSucceeded {
+			cloned = append(cloned, plugins[i])
 		}
 	}
-	logger.Debug("completed installing plugins")
+	if err = addToLock(ctx, logger, client, confPath, pluginsPath, cloned); err != nil {
+		return summary, err
+	}
 
-	return nil
+	return summary, summary.Err()
 }
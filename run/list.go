@@ -0,0 +1,209 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// State is the state of a plugin directory.
+type State string
+
+const (
+	// StateClean is when the plugin is installed and has no uncommitted changes.
+	StateClean State = "clean"
+	// StateDirty is when the plugin is installed and has uncommitted changes.
+	StateDirty State = "dirty"
+	// StateMissing is when the plugin is configured but not installed.
+	StateMissing State = "missing"
+	// StateOrphaned is when the plugin is installed but not configured. Clean removes it.
+	StateOrphaned State = "orphaned"
+	// StateUnknown is when the state of the installed plugin could not be determined.
+	StateUnknown State = "unknown"
+)
+
+// PluginStatus is the status of a plugin.
+type PluginStatus struct {
+	Name  string `json:"name"`
+	URL   string `json:"url,omitempty"`
+	State State  `json:"state"`
+	// Ref is the branch, tag, commit or semver constraint declared for the plugin. Empty means
+	// the default branch.
+	Ref    string `json:"ref,omitempty"`
+	Path   string `json:"path"`
+	Commit string `json:"commit,omitempty"`
+	// Upstream is the branch the plugin tracks. Ahead and Behind are relative to it as of the
+	// last fetch.
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	// Error is set when the status of the plugin could not be fully determined.
+	Error string `json:"error,omitempty"`
+}
+
+// Status is the status of every configured plugin and the orphaned plugin directories.
+type Status struct {
+	Plugins  []PluginStatus `json:"plugins"`
+	Orphaned []PluginStatus `json:"orphaned"`
+}
+
+// List returns the status of every configured plugin and any orphaned plugin directory that
+// Clean would remove. It does not fetch from remotes.
+func List(ctx context.Context, logger *slog.Logger, opts Options) (Status, error) {
+	logger.Debug("listing plugins")
+
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		return Status{}, err
+	}
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Status{}, err
+	}
+
+	plugins, err := getPlugins(logger, confPath)
+	if err != nil {
+		return Status{}, err
+	}
+
+	client := opts.git(logger)
+
+	status := Status{Plugins: []PluginStatus{}, Orphaned: []PluginStatus{}}
+	for _, plugin := range plugins {
+		status.Plugins = append(status.Plugins, pluginStatus(ctx, logger, client, plugin, filepath.Join(pluginsPath, plugin.Repo)))
+	}
+
+	if _, err = os.Stat(pluginsPath); err != nil {
+		if os.IsNotExist(err) {
+			logger.Debug("plugins directory does not exist", "path", pluginsPath)
+			return status, nil
+		}
+		return Status{}, fmt.Errorf("failed to check if plugins directory exists: %w", err)
+	}
+
+	orphaned, err := orphanedPlugins(pluginsPath, plugins)
+	if err != nil {
+		return Status{}, err
+	}
+	for _, name := range orphaned {
+		status.Orphaned = append(status.Orphaned, PluginStatus{
+			Name:  name,
+			State: StateOrphaned,
+			Path:  filepath.Join(pluginsPath, name),
+		})
+	}
+
+	return status, nil
+}
+
+func pluginStatus(ctx context.Context, logger *slog.Logger, client git.Client, plugin tmux.Plugin, path string) PluginStatus {
+	status := PluginStatus{
+		Name: plugin.Repo,
+		URL:  plugin.URL,
+		Ref:  plugin.Ref.String(),
+		Path: path,
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		status.State = StateMissing
+		if !os.IsNotExist(err) {
+			status.Error = err.Error()
+		}
+		return status
+	}
+
+	status.State = StateUnknown
+
+	var err error
+	if status.Commit, err = client.RevParse(ctx, path, "HEAD"); err != nil {
+		logger.Debug("failed to get commit of plugin", "plugin", plugin.Repo, "error", err)
+		status.Error = err.Error()
+		return status
+	}
+
+	gitStatus, err := client.Status(ctx, path)
+	if err != nil {
+		logger.Debug("failed to get status of plugin", "plugin", plugin.Repo, "error", err)
+		status.Error = err.Error()
+		return status
+	}
+	status.State = StateClean
+	if gitStatus.Dirty {
+		status.State = StateDirty
+	}
+	status.Upstream = gitStatus.Upstream
+	status.Ahead = gitStatus.Ahead
+	status.Behind = gitStatus.Behind
+	return status
+}
+
+// Format is the format the status of plugins is written in.
+type Format string
+
+const (
+	// FormatTable writes the status as a table with a header.
+	FormatTable Format = "table"
+	// FormatPlain writes the status as tab separated lines without a header.
+	FormatPlain Format = "plain"
+	// FormatJSON writes the status as a JSON object.
+	FormatJSON Format = "json"
+)
+
+// Print writes the status in the format to w.
+func (s Status) Print(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	case FormatPlain:
+		for _, p := range append(s.Plugins, s.Orphaned...) {
+			if _, err := fmt.Fprintln(w, p.row()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSTATE\tREF\tCOMMIT\tAHEAD\tBEHIND\tPATH")
+		for _, p := range append(s.Plugins, s.Orphaned...) {
+			fmt.Fprintln(tw, p.row())
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+}
+
+// row returns the tab separated columns of the status. Unknown values are written as -.
+func (p PluginStatus) row() string {
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	ahead, behind := "-", "-"
+	if p.Upstream != "" {
+		ahead, behind = strconv.Itoa(p.Ahead), strconv.Itoa(p.Behind)
+	}
+
+	return p.Name + "\t" +
+		string(p.State) + "\t" +
+		orDash(p.Ref) + "\t" +
+		orDash(shortCommit(p.Commit)) + "\t" +
+		ahead + "\t" +
+		behind + "\t" +
+		p.Path
+}
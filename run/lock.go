@@ -0,0 +1,114 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// readLock reads the lock file next to the tmux conf file. An empty lock file is returned
+// if one does not exist yet.
+func readLock(logger *slog.Logger, confPath string) (lock.File, error) {
+	path := lock.Path(confPath)
+	f, err := lock.Read(path)
+	if err != nil {
+		if errors.Is(err, lock.ErrNotFound) {
+			logger.Debug("lock file does not exist", "path", path)
+			return lock.File{}, nil
+		}
+		return lock.File{}, err
+	}
+	logger.Debug("read lock file", "path", path, "plugins", len(f.Plugins))
+	return f, nil
+}
+
+// lockedCommit returns the commit the plugin is locked to. A plugin is only considered locked
+// if its URL and ref have not changed since the lock file was written.
+func lockedCommit(f lock.File, plugin tmux.Plugin) (string, bool) {
+	locked, ok := f.Get(plugin.Repo)
+	if !ok || locked.URL != plugin.URL || locked.Ref != plugin.Ref.String() || locked.Commit == "" {
+		return "", false
+	}
+	return locked.Commit, true
+}
+
+// updateLock records the current commit of the plugins the summary succeeded for in the lock
+// file next to the tmux conf file. Entries of plugins no longer configured are dropped, and
+// every other entry is kept as it is, including plugins not installed on this machine.
+func updateLock(ctx context.Context, logger *slog.Logger, client git.Client, confPath string, pluginsPath string, configured []tmux.Plugin, summary Summary) error {
+	f, err := readLock(logger, confPath)
+	if err != nil {
+		return err
+	}
+	f.Plugins = slices.DeleteFunc(f.Plugins, func(p lock.Plugin) bool {
+		return !slices.ContainsFunc(configured, func(c tmux.Plugin) bool { return c.Repo == p.Name })
+	})
+
+	var acted []tmux.Plugin
+	for _, r := range summary.Results {
+		if r.Outcome != OutcomeSucceeded {
+			continue
+		}
+		if i := slices.IndexFunc(configured, func(c tmux.Plugin) bool { return c.Repo == r.Plugin }); i >= 0 {
+			acted = append(acted, configured[i])
+		}
+	}
+	if err = lockPlugins(ctx, logger, client, &f, pluginsPath, acted); err != nil {
+		return err
+	}
+	path := lock.Path(confPath)
+	logger.Debug("writing lock file", "path", path, "plugins", len(f.Plugins))
+	return lock.Write(path, f)
+}
+
+// addToLock records the current commit of the plugins in the lock file next to the tmux conf
+// file. The entries of every other plugin are kept as they are.
+func addToLock(ctx context.Context, logger *slog.Logger, client git.Client, confPath string, pluginsPath string, plugins []tmux.Plugin) error {
+	if len(plugins) == 0 {
+		return nil
+	}
+	f, err := readLock(logger, confPath)
+	if err != nil {
+		return err
+	}
+	if err = lockPlugins(ctx, logger, client, &f, pluginsPath, plugins); err != nil {
+		return err
+	}
+	path := lock.Path(confPath)
+	logger.Debug("writing lock file", "path", path, "plugins", len(f.Plugins))
+	return lock.Write(path, f)
+}
+
+// lockPlugins sets the current commit of every installed plugin in the lock file.
+func lockPlugins(ctx context.Context, logger *slog.Logger, client git.Client, f *lock.File, pluginsPath string, plugins []tmux.Plugin) error {
+	for _, p := range plugins {
+		path := filepath.Join(pluginsPath, p.Repo)
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				logger.Debug("plugin is not installed, not adding to lock file", "plugin", p.Repo)
+				continue
+			}
+			return fmt.Errorf("failed to check if plugin "+p.Repo+" is installed: %w", err)
+		}
+
+		commit, err := client.RevParse(ctx, path, "HEAD")
+		if err != nil {
+			return &PluginError{Plugin: p.Repo, Err: err}
+		}
+		f.Set(lock.Plugin{
+			Name:   p.Repo,
+			URL:    p.URL,
+			Ref:    p.Ref.String(),
+			Commit: commit,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// sourceCommand is the command that sources the plugins with gtpm.
+const sourceCommand = "run 'gtpm source'"
+
+// MigrateAction is what Migrate did with a plugin.
+type MigrateAction string
+
+const (
+	// MigrateAdopted is when the plugin is already in the plugin directory of gtpm.
+	MigrateAdopted MigrateAction = "adopted"
+	// MigrateMoved is when the plugin was moved from the plugin directory of tpm.
+	MigrateMoved MigrateAction = "moved"
+	// MigrateMissing is when the plugin is not installed. Install clones it.
+	MigrateMissing MigrateAction = "missing"
+	// MigrateFailed is when the plugin could not be migrated. The reason is in the problems.
+	MigrateFailed MigrateAction = "failed"
+)
+
+// Migration is the result of migrating a tpm setup to gtpm.
+type Migration struct {
+	DryRun     bool   `json:"dry_run,omitempty"`
+	ConfigPath string `json:"config_path"`
+	// BackupPath is the copy of the tmux conf file before it was rewritten.
+	BackupPath string `json:"backup_path,omitempty"`
+	// Changes are the lines of the tmux conf file that were rewritten.
+	Changes []ConfigChange  `json:"changes"`
+	Plugins []PluginMigrate `json:"plugins"`
+	// TPMPath is where tpm is still installed.
+	TPMPath string `json:"tpm_path,omitempty"`
+	// Problems are what could not be migrated and has to be done by hand.
+	Problems []string `json:"problems"`
+}
+
+// ConfigChange is a line of the tmux conf file that was rewritten.
+type ConfigChange struct {
+	Line int    `json:"line"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// PluginMigrate is what was done with a plugin.
+type PluginMigrate struct {
+	Plugin string        `json:"plugin"`
+	Action MigrateAction `json:"action"`
+	From   string        `json:"from,omitempty"`
+	Path   string        `json:"path"`
+}
+
+// Migrate converts a tpm setup to gtpm. The run line of tpm in the tmux conf file is replaced
+// with run 'gtpm source' and the tmux-plugins/tpm plugin is commented out, after backing up the
+// file. Plugins tpm already cloned are adopted when they are in the plugin directory of gtpm, or
+// moved there otherwise, and recorded in the lock file.
+//
+// Only the tmux conf file is rewritten, not the files it sources. Anything that could not be
+// migrated is returned in the problems of the migration.
+func Migrate(ctx context.Context, logger *slog.Logger, opts Options) (Migration, error) {
+	logger.Debug("migrating from tpm")
+
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		return Migration{}, err
+	}
+	if err = tmux.CheckEditable(confPath); err != nil {
+		return Migration{}, err
+	}
+	m := Migration{DryRun: opts.DryRun, ConfigPath: confPath, Changes: []ConfigChange{}, Plugins: []PluginMigrate{}, Problems: []string{}}
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	src, err := os.ReadFile(confPath)
+	if err != nil {
+		return Migration{}, fmt.Errorf("failed to read %s: %w", confPath, err)
+	}
+	config, err := tmux.Parse(bytes.NewReader(src))
+	if err != nil {
+		return Migration{}, fmt.Errorf("failed to parse %s: %w", confPath, err)
+	}
+
+	var runCommands, pluginCommands []tmux.Command
+	hasSource := false
+	walkCommands(config.Nodes, func(cmd tmux.Command) {
+		switch cmd.PluginManager() {
+		case "tpm":
+			runCommands = append(runCommands, cmd)
+		case "gtpm":
+			hasSource = true
+		}
+		if opt, ok := cmd.Option(); ok && opt.Name == "@plugin" && !opt.Unset {
+			if plugin, err := tmux.ParsePlugin(opt.Value); err == nil && plugin.Repo == "tpm" {
+				pluginCommands = append(pluginCommands, cmd)
+			}
+		}
+	})
+
+	tpmPluginsPath := filepath.Join(os.Getenv("HOME"), ".tmux", "plugins")
+	if len(runCommands) > 0 {
+		if p := tpmExecutable(runCommands[0]); p != "" {
+			tpmPluginsPath = filepath.Dir(filepath.Dir(p))
+		}
+	}
+	tpmPath := filepath.Join(tpmPluginsPath, "tpm")
+	_, statErr := os.Stat(tpmPath)
+	if len(runCommands) == 0 && len(pluginCommands) == 0 && statErr != nil {
+		return Migration{}, errors.New("no tpm setup found in " + confPath + " or " + tpmPluginsPath)
+	}
+	if statErr == nil {
+		m.TPMPath = tpmPath
+	}
+	logger.Debug("found tpm setup", "path", tpmPluginsPath, "run_lines", len(runCommands), "plugin_lines", len(pluginCommands))
+
+	lines := tmux.SplitLines(src)
+	var edits []tmux.Edit
+	for _, cmd := range runCommands {
+		if !tmux.OwnsLines(lines, cmd) {
+			m.Problems = append(m.Problems, fmt.Sprintf("%s:%d: remove the tpm run line by hand", confPath, cmd.StartLine))
+			continue
+		}
+		if hasSource {
+			edits = append(edits, commentOut(lines, cmd, &m))
+			continue
+		}
+		hasSource = true
+		edit := tmux.Edit{StartLine: cmd.StartLine, EndLine: cmd.EndLine, Lines: []string{indentation(lines[cmd.StartLine-1]) + sourceCommand}}
+		m.Changes = append(m.Changes, ConfigChange{Line: cmd.StartLine, From: strings.Join(lines[cmd.StartLine-1:cmd.EndLine], "\n"), To: edit.Lines[0]})
+		edits = append(edits, edit)
+	}
+	for _, cmd := range pluginCommands {
+		if !tmux.OwnsLines(lines, cmd) {
+			m.Problems = append(m.Problems, fmt.Sprintf("%s:%d: remove the tmux-plugins/tpm plugin by hand", confPath, cmd.StartLine))
+			continue
+		}
+		edits = append(edits, commentOut(lines, cmd, &m))
+	}
+	if !hasSource {
+		edits = append(edits, tmux.Edit{StartLine: len(lines) + 1, EndLine: len(lines), Lines: []string{sourceCommand}})
+		m.Changes = append(m.Changes, ConfigChange{Line: len(lines) + 1, To: sourceCommand})
+	}
+
+	slices.SortFunc(m.Changes, func(a, b ConfigChange) int { return a.Line - b.Line })
+
+	if len(edits) > 0 && !opts.DryRun {
+		content, err := tmux.ApplyEdits(src, edits)
+		if err != nil {
+			return m, err
+		}
+		if m.BackupPath, err = tmux.BackupFile(confPath); err != nil {
+			return m, err
+		}
+		if err = tmux.WriteFile(confPath, content); err != nil {
+			return m, err
+		}
+		logger.Debug("rewrote tmux conf file", "path", confPath, "backup", m.BackupPath)
+	}
+
+	plugins, err := getPlugins(logger, confPath)
+	if err != nil {
+		return m, err
+	}
+	var migrated []tmux.Plugin
+	for _, plugin := range plugins {
+		if plugin.Repo == "tpm" {
+			continue
+		}
+		p := migratePlugin(logger, plugin, tpmPluginsPath, pluginsPath, opts.DryRun, &m)
+		m.Plugins = append(m.Plugins, p)
+		if p.Action == MigrateAdopted || p.Action == MigrateMoved {
+			migrated = append(migrated, plugin)
+		}
+	}
+
+	if len(migrated) > 0 && !opts.DryRun {
+		client := opts.git(logger)
+		if !client.IsInstalled(ctx) {
+			m.Problems = append(m.Problems, "git is not installed, run gtpm install once it is to write "+lock.FileName)
+		} else if err = addToLock(ctx, logger, client, confPath, pluginsPath, migrated); err != nil {
+			m.Problems = append(m.Problems, "failed to write lock file: "+err.Error())
+		}
+	}
+
+	logger.Debug("completed migrating from tpm", "changes", len(m.Changes), "plugins", len(m.Plugins), "problems", len(m.Problems))
+	return m, nil
+}
+
+// walkCommands calls fn with every command of the nodes, including the commands in every block of
+// conditionals.
+func walkCommands(nodes []tmux.Node, fn func(tmux.Command)) {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case tmux.Command:
+			fn(n)
+		case tmux.Conditional:
+			for _, branch := range n.Branches {
+				walkCommands(branch.Nodes, fn)
+			}
+			walkCommands(n.Else, fn)
+		}
+	}
+}
+
+// tpmExecutable returns the path of the tpm executable the run command runs.
+func tpmExecutable(cmd tmux.Command) string {
+	for _, arg := range cmd.Args {
+		for _, field := range strings.Fields(arg) {
+			if filepath.Base(field) != "tpm" {
+				continue
+			}
+			if field == "~" || strings.HasPrefix(field, "~/") {
+				field = filepath.Join(os.Getenv("HOME"), field[1:])
+			}
+			return os.ExpandEnv(field)
+		}
+	}
+	return ""
+}
+
+// commentOut comments out the lines of the command and records the change.
+func commentOut(lines []string, cmd tmux.Command, m *Migration) tmux.Edit {
+	edit := tmux.Edit{StartLine: cmd.StartLine, EndLine: cmd.EndLine}
+	for i := cmd.StartLine; i <= cmd.EndLine; i++ {
+		line := lines[i-1]
+		commented := indentation(line) + "# " + strings.TrimLeft(line, " \t")
+		edit.Lines = append(edit.Lines, commented)
+		m.Changes = append(m.Changes, ConfigChange{Line: i, From: line, To: commented})
+	}
+	return edit
+}
+
+func indentation(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// migratePlugin adopts the plugin when it is in the plugin directory of gtpm, or moves it there
+// from the plugin directory of tpm.
+func migratePlugin(logger *slog.Logger, plugin tmux.Plugin, tpmPluginsPath string, pluginsPath string, dryRun bool, m *Migration) PluginMigrate {
+	path := filepath.Join(pluginsPath, plugin.Repo)
+	tpmPath := filepath.Join(tpmPluginsPath, plugin.Repo)
+	p := PluginMigrate{Plugin: plugin.Repo, Path: path}
+
+	_, err := os.Stat(path)
+	installed := err == nil
+	_, err = os.Stat(tpmPath)
+	installedByTPM := err == nil && tpmPath != path
+
+	switch {
+	case installed:
+		logger.Debug("adopting plugin", "plugin", plugin.Repo, "path", path)
+		p.Action = MigrateAdopted
+		if installedByTPM {
+			m.Problems = append(m.Problems, plugin.Repo+" is installed at "+path+" and "+tpmPath+", remove "+tpmPath+" by hand")
+		}
+	case installedByTPM:
+		logger.Debug("moving plugin", "plugin", plugin.Repo, "from", tpmPath, "to", path)
+		p.Action = MigrateMoved
+		p.From = tpmPath
+		if dryRun {
+			break
+		}
+		if err = tmux.CreatePluginsDir(pluginsPath); err == nil {
+			err = os.Rename(tpmPath, path)
+		}
+		if err != nil {
+			p.Action = MigrateFailed
+			m.Problems = append(m.Problems, "failed to move "+tpmPath+" to "+path+", move it by hand: "+err.Error())
+		}
+	default:
+		p.Action = MigrateMissing
+	}
+	return p
+}
+
+// Print writes what the migration did (or would do on a dry run) to w.
+func (m Migration) Print(w io.Writer) error {
+	var b strings.Builder
+	would := func(done string, planned string) string {
+		if m.DryRun {
+			return planned
+		}
+		return done
+	}
+
+	if len(m.Changes) > 0 {
+		b.WriteString(would("rewrote ", "would rewrite ") + m.ConfigPath)
+		if m.BackupPath != "" {
+			b.WriteString(" (backup at " + m.BackupPath + ")")
+		}
+		b.WriteString("\n")
+		for _, c := range m.Changes {
+			if c.From == "" {
+				fmt.Fprintf(&b, "  line %d: added %s\n", c.Line, c.To)
+				continue
+			}
+			fmt.Fprintf(&b, "  line %d: %s -> %s\n", c.Line, c.From, c.To)
+		}
+	}
+	for _, p := range m.Plugins {
+		switch p.Action {
+		case MigrateAdopted:
+			b.WriteString(would("adopted ", "would adopt ") + p.Plugin + " at " + p.Path + "\n")
+		case MigrateMoved:
+			b.WriteString(would("moved ", "would move ") + p.Plugin + " from " + p.From + " to " + p.Path + "\n")
+		case MigrateMissing:
+			b.WriteString(p.Plugin + " is not installed, run gtpm install\n")
+		}
+	}
+	if m.TPMPath != "" {
+		b.WriteString("tpm is still installed at " + m.TPMPath + ", remove it once gtpm works\n")
+	}
+	if len(m.Problems) > 0 {
+		b.WriteString("could not migrate:\n")
+		for _, problem := range m.Problems {
+			b.WriteString("  " + problem + "\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
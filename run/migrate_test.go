@@ -0,0 +1,147 @@
+package run_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/Piszmog/gtpm/run"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const tpmConf = `# plugins
+set -g @plugin 'tmux-plugins/tpm'
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+
+set -g status-left '' # keep me
+  run '~/.tmux/plugins/tpm/tpm'
+`
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name             string
+		dryRun           bool
+		expectedConf     string
+		expectedPlugins  []run.PluginMigrate
+		expectedChanges  int
+		expectedLock     []string
+		expectedProblems int
+	}{
+		{
+			name: "Migrate",
+			expectedConf: `# plugins
+# set -g @plugin 'tmux-plugins/tpm'
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+
+set -g status-left '' # keep me
+  run 'gtpm source'
+`,
+			expectedChanges: 2,
+			expectedLock:    []string{"tmux-sensible", "tmux-yank"},
+		},
+		{
+			name:            "Dry Run",
+			dryRun:          true,
+			expectedConf:    tpmConf,
+			expectedChanges: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, tpmConf)
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			pluginsPath := filepath.Join(dir, "plugins")
+			tpmPluginsPath := filepath.Join(home, ".tmux", "plugins")
+			require.NoError(t, os.MkdirAll(filepath.Join(tpmPluginsPath, "tpm"), os.ModePerm))
+
+			gitClient := newFake()
+			require.NoError(t, gitClient.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+			// the fake knows the repository by the path it is moved to
+			require.NoError(t, gitClient.Clone(context.Background(), yankURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-yank"), nil))
+			require.NoError(t, os.Rename(filepath.Join(pluginsPath, "tmux-yank"), filepath.Join(tpmPluginsPath, "tmux-yank")))
+
+			migration, err := run.Migrate(context.Background(), logger, run.Options{Git: gitClient, DryRun: test.dryRun})
+			require.NoError(t, err)
+
+			assert.Len(t, migration.Changes, test.expectedChanges)
+			assert.Empty(t, migration.Problems)
+			assert.Equal(t, filepath.Join(tpmPluginsPath, "tpm"), migration.TPMPath)
+			assert.Equal(t, []run.PluginMigrate{
+				{Plugin: "tmux-sensible", Action: run.MigrateAdopted, Path: filepath.Join(pluginsPath, "tmux-sensible")},
+				{Plugin: "tmux-yank", Action: run.MigrateMoved, From: filepath.Join(tpmPluginsPath, "tmux-yank"), Path: filepath.Join(pluginsPath, "tmux-yank")},
+				{Plugin: "tmux-resurrect", Action: run.MigrateMissing, Path: filepath.Join(pluginsPath, "tmux-resurrect")},
+			}, migration.Plugins)
+
+			confPath := filepath.Join(dir, "tmux.conf")
+			conf, err := os.ReadFile(confPath)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedConf, string(conf))
+
+			_, err = os.Stat(filepath.Join(pluginsPath, "tmux-yank"))
+			if test.dryRun {
+				assert.Empty(t, migration.BackupPath)
+				assert.True(t, os.IsNotExist(err))
+				assert.NoFileExists(t, lock.Path(confPath))
+				return
+			}
+			assert.NoError(t, err)
+
+			backup, err := os.ReadFile(migration.BackupPath)
+			require.NoError(t, err)
+			assert.Equal(t, tpmConf, string(backup))
+
+			f, err := lock.Read(lock.Path(confPath))
+			require.NoError(t, err)
+			var locked []string
+			for _, p := range f.Plugins {
+				locked = append(locked, p.Name)
+			}
+			assert.ElementsMatch(t, test.expectedLock, locked)
+
+			var out bytes.Buffer
+			require.NoError(t, migration.Print(&out))
+			assert.Contains(t, out.String(), "moved tmux-yank")
+		})
+	}
+}
+
+func TestMigrate_Source(t *testing.T) {
+	dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'
+run 'gtpm source'
+run -b '~/.tmux/plugins/tpm/tpm'
+`)
+	t.Setenv("HOME", t.TempDir())
+
+	migration, err := run.Migrate(context.Background(), logger, run.Options{Git: newFake()})
+	require.NoError(t, err)
+	assert.Equal(t, []run.ConfigChange{
+		{Line: 3, From: "run -b '~/.tmux/plugins/tpm/tpm'", To: "# run -b '~/.tmux/plugins/tpm/tpm'"},
+	}, migration.Changes)
+
+	conf, err := os.ReadFile(filepath.Join(dir, "tmux.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, `set -g @plugin 'tmux-plugins/tmux-sensible'
+run 'gtpm source'
+# run -b '~/.tmux/plugins/tpm/tpm'
+`, string(conf))
+}
+
+func TestMigrate_NoTPM(t *testing.T) {
+	setupConfig(t, "set -g @plugin 'tmux-plugins/tmux-sensible'\nrun 'gtpm source'\n")
+	t.Setenv("HOME", t.TempDir())
+
+	_, err := run.Migrate(context.Background(), logger, run.Options{Git: newFake()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no tpm setup found")
+}
@@ -0,0 +1,28 @@
+package run
+
+import "github.com/Piszmog/gtpm/git"
+
+// Observer is notified as plugins are installed, updated, removed or sourced, so callers can
+// show their own progress or collect metrics. The methods are called from several goroutines at
+// the same time when Options.Jobs is greater than 1.
+type Observer interface {
+	// PluginStarted is called when the action on the plugin starts.
+	PluginStarted(plugin string, action ActionKind)
+	// CloneProgress is called with the progress git reports while the plugin is cloned.
+	CloneProgress(plugin string, progress git.CloneProgress)
+	// PluginDone is called when the action on the plugin succeeded or there was nothing to do.
+	PluginDone(plugin string, action ActionKind, result Result)
+	// PluginFailed is called when the action on the plugin failed.
+	PluginFailed(plugin string, action ActionKind, err error)
+}
+
+// NopObserver is an Observer that ignores everything. Embed it to only implement the methods
+// of interest.
+type NopObserver struct{}
+
+var _ Observer = NopObserver{}
+
+func (NopObserver) PluginStarted(string, ActionKind)        {}
+func (NopObserver) CloneProgress(string, git.CloneProgress) {}
+func (NopObserver) PluginDone(string, ActionKind, Result)   {}
+func (NopObserver) PluginFailed(string, ActionKind, error)  {}
@@ -0,0 +1,82 @@
+package run
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// Options configures how plugins are managed.
+type Options struct {
+	// Jobs is the maximum number of plugins that are cloned or updated at the same time.
+	// Values less than 1 process one plugin at a time.
+	Jobs int
+	// DryRun only plans the actions that would be performed without touching the disk or network.
+	DryRun bool
+	// IgnoreLock installs the latest commit of plugins instead of the commit in the lock file.
+	IgnoreLock bool
+	// Git is the client used to run git operations. Defaults to running the git executable.
+	Git git.Client
+	// Tmux is the client used to run tmux commands. Defaults to running the tmux executable.
+	Tmux tmux.Client
+	// ConfigPath is the path of the tmux conf file. Defaults to the file found by
+	// tmux.FindConfigFile.
+	ConfigPath string
+	// PluginsDir is the directory plugins are installed to. Defaults to the directory found by
+	// tmux.PluginsDir.
+	PluginsDir string
+	// Timeout is how long acting on a single plugin (e.g. cloning it) can take. Zero means there
+	// is no limit.
+	Timeout time.Duration
+	// Observer is notified as the plugins are acted on. Defaults to ignoring everything.
+	Observer Observer
+}
+
+func (o Options) git(logger *slog.Logger) git.Client {
+	if o.Git == nil {
+		return git.NewExecClient(logger)
+	}
+	return o.Git
+}
+
+func (o Options) tmux() tmux.Client {
+	if o.Tmux == nil {
+		return tmux.NewExecClient()
+	}
+	return o.Tmux
+}
+
+// server returns the client used to query the running tmux server for its conf file and
+// environment. It is nil when not running inside tmux and no client is given.
+func (o Options) server() tmux.Client {
+	if o.Tmux == nil && os.Getenv("TMUX") == "" {
+		return nil
+	}
+	return o.tmux()
+}
+
+func (o Options) observer() Observer {
+	if o.Observer == nil {
+		return NopObserver{}
+	}
+	return o.Observer
+}
+
+func (o Options) jobs() int {
+	if o.Jobs < 1 {
+		return 1
+	}
+	return o.Jobs
+}
+
+// withTimeout returns the context for acting on a single plugin.
+func (o Options) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.Timeout)
+}
@@ -0,0 +1,313 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/semver"
+	"github.com/Piszmog/gtpm/state"
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// OutdatedFileName is the name of the file in the state directory of a tmux conf file the last
+// outdated report is cached in.
+const OutdatedFileName = "outdated.json"
+
+// OutdatedPlugin is whether an installed plugin has an update available.
+type OutdatedPlugin struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	// Outdated is when the plugin is behind its branch or a newer tag is available.
+	Outdated bool `json:"outdated"`
+	// Behind is the number of commits the plugin is behind its branch or the newest tag
+	// satisfying its semver constraint.
+	Behind int `json:"behind"`
+	// Latest is the newest commit of the branch the plugin tracks, or the newest tag for plugins
+	// pinned to a tag or semver constraint.
+	Latest string `json:"latest,omitempty"`
+	// Subject is the subject of the newest commit, when it is known.
+	Subject string `json:"subject,omitempty"`
+	// Error is set when it could not be determined if the plugin is outdated.
+	Error string `json:"error,omitempty"`
+}
+
+// OutdatedReport is whether every installed plugin has an update available.
+type OutdatedReport struct {
+	// Time is when the remotes were fetched.
+	Time    time.Time        `json:"time"`
+	Plugins []OutdatedPlugin `json:"plugins"`
+}
+
+// Count returns the number of plugins with an update available.
+func (r OutdatedReport) Count() int {
+	count := 0
+	for _, p := range r.Plugins {
+		if p.Outdated {
+			count++
+		}
+	}
+	return count
+}
+
+// Outdated fetches every installed plugin and reports which are behind the branch they track
+// or have a newer tag available. Nothing is changed besides the remote-tracking branches and
+// tags. The report is cached in the state directory of the tmux conf file.
+//
+// When maxAge is positive and the cached report is younger than it, the cached report is
+// returned without fetching.
+func Outdated(ctx context.Context, logger *slog.Logger, opts Options, maxAge time.Duration) (OutdatedReport, error) {
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		return OutdatedReport{}, err
+	}
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return OutdatedReport{}, err
+	}
+
+	cachePath := filepath.Join(state.ConfigDir(confPath, pluginsPath), OutdatedFileName)
+	if maxAge > 0 {
+		report, ok, err := readOutdatedReport(cachePath)
+		if err != nil {
+			return OutdatedReport{}, err
+		}
+		if ok && time.Since(report.Time) < maxAge {
+			logger.Debug("using cached report", "path", cachePath, "time", report.Time)
+			return report, nil
+		}
+		logger.Debug("cached report is missing or too old", "path", cachePath)
+	}
+
+	client := opts.git(logger)
+
+	logger.Debug("checking if git is install")
+	if !client.IsInstalled(ctx) {
+		return OutdatedReport{}, fmt.Errorf("%w to check for updates", ErrGitNotInstalled)
+	}
+
+	plugins, err := getPlugins(logger, confPath)
+	if err != nil {
+		return OutdatedReport{}, err
+	}
+
+	files, err := readPluginsDir(pluginsPath)
+	if err != nil {
+		return OutdatedReport{}, err
+	}
+
+	var installed []tmux.Plugin
+	for _, plugin := range plugins {
+		if isInstalled(plugin, files) {
+			installed = append(installed, plugin)
+		} else {
+			logger.Debug("plugin is not installed, not checking for updates", "plugin", plugin.Repo)
+		}
+	}
+
+	report := OutdatedReport{Time: time.Now().UTC()}
+	report.Plugins = forEach(opts.jobs(), installed, func(plugin tmux.Plugin) OutdatedPlugin {
+		pluginCtx, cancel := opts.withTimeout(ctx)
+		defer cancel()
+		return checkOutdated(pluginCtx, logger, client, plugin, filepath.Join(pluginsPath, plugin.Repo))
+	})
+	if err = ctx.Err(); err != nil {
+		// a cancelled check is not cached, as it is missing the plugins that were not checked
+		return report, err
+	}
+
+	if err = writeOutdatedReport(cachePath, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func checkOutdated(ctx context.Context, logger *slog.Logger, client git.Client, plugin tmux.Plugin, path string) OutdatedPlugin {
+	p := OutdatedPlugin{Name: plugin.Repo, URL: plugin.URL, Ref: plugin.Ref.String()}
+	if err := checkPluginOutdated(ctx, logger, client, plugin, path, &p); err != nil {
+		logger.Debug("failed to check if plugin is outdated", "plugin", plugin.Repo, "error", err)
+		p.Error = err.Error()
+	}
+	p.Outdated = p.Behind > 0 || p.Latest != ""
+	return p
+}
+
+func checkPluginOutdated(ctx context.Context, logger *slog.Logger, client git.Client, plugin tmux.Plugin, path string, p *OutdatedPlugin) error {
+	var err error
+	if p.Commit, err = client.RevParse(ctx, path, "HEAD"); err != nil {
+		return err
+	}
+
+	switch plugin.Ref.Type {
+	case git.RefDefault, git.RefBranch:
+		if err = client.Fetch(ctx, path); err != nil {
+			return err
+		}
+		status, err := client.Status(ctx, path)
+		if err != nil {
+			return err
+		}
+		if status.Upstream == "" {
+			return errors.New("the plugin does not track a remote branch")
+		}
+		p.Behind = status.Behind
+		if p.Behind == 0 {
+			return nil
+		}
+		return setLatestCommit(ctx, client, path, p.Commit, status.Upstream, p)
+	case git.RefTag:
+		// a plugin pinned to a tag never moves, but a newer version is worth knowing about
+		if _, err = semver.Parse(plugin.Ref.Name); err != nil {
+			logger.Debug("tag is not a version, not checking for newer tags", "plugin", plugin.Repo, "tag", plugin.Ref.Name)
+			return nil
+		}
+		constraint, err := semver.ParseConstraint(">" + plugin.Ref.Name)
+		if err != nil {
+			return err
+		}
+		tags, err := client.ListRemoteTags(ctx, plugin.URL)
+		if err != nil {
+			return err
+		}
+		p.Latest, _ = constraint.Latest(tags)
+		return nil
+	case git.RefSemver:
+		ref, err := resolveRef(ctx, logger, client, plugin.URL, plugin.Ref)
+		if err != nil {
+			return err
+		}
+		if err = client.Fetch(ctx, path, "+refs/tags/"+ref.Name+":refs/tags/"+ref.Name); err != nil {
+			return err
+		}
+		commit, err := client.RevParse(ctx, path, ref.Name)
+		if err != nil {
+			return err
+		}
+		if commit == p.Commit {
+			return nil
+		}
+		p.Latest = ref.Name
+		return setLatestCommit(ctx, client, path, p.Commit, ref.Name, p)
+	default:
+		return nil
+	}
+}
+
+// setLatestCommit sets the number of commits between the commit and the upstream ref, and the
+// subject of the newest one.
+func setLatestCommit(ctx context.Context, client git.Client, path string, commit string, upstream string, p *OutdatedPlugin) error {
+	commits, err := client.Log(ctx, path, commit, upstream)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+	p.Behind = len(commits)
+	if p.Latest == "" {
+		p.Latest = commits[0].SHA
+	}
+	p.Subject = commits[0].Subject
+	return nil
+}
+
+func readOutdatedReport(path string) (OutdatedReport, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return OutdatedReport{}, false, nil
+		}
+		return OutdatedReport{}, false, fmt.Errorf("failed to read cached report: %w", err)
+	}
+	var report OutdatedReport
+	if err = json.Unmarshal(data, &report); err != nil {
+		return OutdatedReport{}, false, fmt.Errorf("failed to parse cached report "+path+": %w", err)
+	}
+	return report, true, nil
+}
+
+func writeOutdatedReport(path string, report OutdatedReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err = os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cached report: %w", err)
+	}
+	return nil
+}
+
+// Print writes the report in the format to w. The plain format only writes the plugins with an
+// update available.
+func (r OutdatedReport) Print(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case FormatPlain:
+		for _, p := range r.Plugins {
+			if !p.Outdated {
+				continue
+			}
+			if _, err := fmt.Fprintln(w, p.row()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tREF\tCOMMIT\tBEHIND\tLATEST\tSUBJECT")
+		for _, p := range r.Plugins {
+			fmt.Fprintln(tw, p.row())
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%d of %d plugins have updates available\n", r.Count(), len(r.Plugins))
+		return err
+	default:
+		return fmt.Errorf("unknown format %s", format)
+	}
+}
+
+// row returns the tab separated columns of the plugin. Unknown values are written as -.
+func (p OutdatedPlugin) row() string {
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	subject := p.Subject
+	if p.Error != "" {
+		subject = "error: " + p.Error
+	}
+	latest := p.Latest
+	if !git.ParseRef(p.Ref).IsPinned() {
+		latest = shortCommit(latest)
+	}
+
+	return p.Name + "\t" +
+		orDash(p.Ref) + "\t" +
+		orDash(shortCommit(p.Commit)) + "\t" +
+		strconv.Itoa(p.Behind) + "\t" +
+		orDash(latest) + "\t" +
+		orDash(subject)
+}
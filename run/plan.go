@@ -0,0 +1,243 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Piszmog/gtpm/git"
+)
+
+// ActionKind is the kind of action performed on a plugin.
+type ActionKind string
+
+const (
+	// ActionClone clones the plugin to its path.
+	ActionClone ActionKind = "clone"
+	// ActionPull fetches the latest changes of the plugin at its path and fast-forwards its
+	// branch to them.
+	ActionPull ActionKind = "pull"
+	// ActionCheckout checks out the tag, commit or newest tag satisfying the semver constraint
+	// the plugin is pinned to.
+	ActionCheckout ActionKind = "checkout"
+	// ActionReset resets the plugin at its path to the commit, discarding any local changes.
+	ActionReset ActionKind = "reset"
+	// ActionRemove removes the path.
+	ActionRemove ActionKind = "remove"
+	// ActionSource runs the *.tmux file of the plugin. It is only sent to an Observer by Source
+	// and is never part of a plan.
+	ActionSource ActionKind = "source"
+	// ActionSkip does nothing to the plugin.
+	ActionSkip ActionKind = "skip"
+)
+
+// Action is a single step of a plan.
+type Action struct {
+	Kind ActionKind `json:"kind"`
+	// Plugin is the name of the plugin the action is performed on.
+	Plugin string `json:"plugin"`
+	// URL is the URL the plugin is cloned from.
+	URL string `json:"url,omitempty"`
+	// Ref is the branch, tag, commit or semver constraint the plugin is pinned to.
+	Ref string `json:"ref,omitempty"`
+	// Commit is the commit the plugin is checked out at after it is cloned or reset.
+	Commit string `json:"commit,omitempty"`
+	// Path is the path of the plugin.
+	Path string `json:"path"`
+	// Reason explains why the plugin is skipped.
+	Reason string `json:"reason,omitempty"`
+}
+
+// String describes the action.
+func (a Action) String() string {
+	switch a.Kind {
+	case ActionClone:
+		s := "clone " + a.URL
+		if ref := git.ParseRef(a.Ref); ref.Name != "" {
+			s += " (" + string(ref.Type) + " " + ref.Name + ")"
+		}
+		if a.Commit != "" {
+			s += " at " + a.Commit
+		}
+		return s + " to " + a.Path
+	case ActionPull:
+		return "pull " + a.Path
+	case ActionCheckout:
+		return "checkout " + a.Ref + " in " + a.Path
+	case ActionReset:
+		return "reset " + a.Path + " to " + shortCommit(a.Commit)
+	case ActionRemove:
+		return "remove " + a.Path
+	case ActionSkip:
+		return "skip " + a.Plugin + ": " + a.Reason
+	default:
+		return string(a.Kind) + " " + a.Path
+	}
+}
+
+// Plan is the actions to perform on the plugins.
+type Plan struct {
+	Actions []Action `json:"actions"`
+}
+
+// Print writes every action of the plan to w.
+func (p Plan) Print(w io.Writer) error {
+	if len(p.Actions) == 0 {
+		_, err := fmt.Fprintln(w, "nothing to do")
+		return err
+	}
+	for _, a := range p.Actions {
+		if _, err := fmt.Fprintln(w, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute performs every action of the plan, with at most Options.Jobs actions running at the
+// same time.
+func (p Plan) execute(ctx context.Context, logger *slog.Logger, client git.Client, opts Options) Summary {
+	observer := opts.observer()
+	results := forEach(opts.jobs(), p.Actions, func(a Action) Result {
+		name := a.Plugin
+		if name == "" {
+			name = filepath.Base(a.Path)
+		}
+		observer.PluginStarted(name, a.Kind)
+		start := time.Now()
+		var result Result
+		err := ctx.Err()
+		if err == nil {
+			// actions that have not started when the context is done are not performed
+			actionCtx, cancel := opts.withTimeout(ctx)
+			result, err = a.execute(actionCtx, logger, client, func(progress git.CloneProgress) {
+				observer.CloneProgress(name, progress)
+			})
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				err = fmt.Errorf("timed out after %s: %w", opts.Timeout, err)
+			}
+			cancel()
+		}
+		if err != nil {
+			logger.Debug("failed to "+string(a.Kind)+" plugin", "plugin", name, "error", err)
+			result = Result{Outcome: OutcomeFailed, Err: err}
+		}
+		result.Plugin = name
+		result.Duration = time.Since(start)
+		if err != nil {
+			observer.PluginFailed(name, a.Kind, err)
+		} else {
+			observer.PluginDone(name, a.Kind, result)
+		}
+		return result
+	})
+	return Summary{Plan: p, Results: results}
+}
+
+// clone clones the plugin and checks out the commit it is locked to. When the clone fails, the
+// directory is removed. When only checking out the locked commit fails, the clone is kept.
+func (a Action) clone(ctx context.Context, logger *slog.Logger, client git.Client, ref git.Ref, progress func(git.CloneProgress)) error {
+	if err := client.Clone(ctx, a.URL, ref, a.Path, progress); err != nil {
+		return removeClone(logger, a.Path, err)
+	}
+	if a.Commit == "" {
+		return nil
+	}
+	logger.Debug("checking out locked commit", "plugin", a.Plugin, "commit", a.Commit)
+	err := client.Reset(ctx, a.Path, a.Commit)
+	if err == nil {
+		err = client.SubmoduleUpdate(ctx, a.Path)
+	}
+	if err != nil {
+		return &PluginError{Plugin: a.Plugin, Err: fmt.Errorf("failed to check out locked commit %s: %w", a.Commit, err)}
+	}
+	return nil
+}
+
+// removeClone removes the directory of a plugin whose clone failed (e.g. because it was
+// cancelled), so it is not left half cloned and is cloned again by the next install. The error
+// of the clone is returned.
+func removeClone(logger *slog.Logger, path string, err error) error {
+	logger.Debug("removing partially cloned plugin", "path", path)
+	if rmErr := os.RemoveAll(path); rmErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to remove partially cloned plugin %s: %w", path, rmErr))
+	}
+	return err
+}
+
+// execute performs the action. The progress of a clone is sent to progress. The returned result
+// does not have the plugin set.
+func (a Action) execute(ctx context.Context, logger *slog.Logger, client git.Client, progress func(git.CloneProgress)) (Result, error) {
+	switch a.Kind {
+	case ActionClone:
+		ref, err := resolveRef(ctx, logger, client, a.URL, git.ParseRef(a.Ref))
+		if err != nil {
+			return Result{}, err
+		}
+		logger.Debug("cloning plugin", "plugin", a.Plugin, "url", a.URL, "ref", ref.String())
+		if err = a.clone(ctx, logger, client, ref, progress); err != nil {
+			return Result{}, err
+		}
+		return Result{Outcome: OutcomeSucceeded}, nil
+	case ActionPull:
+		before, after, err := updatePlugin(ctx, logger, client, a.Path)
+		if err != nil {
+			return Result{}, err
+		}
+		if before == after {
+			logger.Debug("plugin is already up to date", "plugin", a.Plugin)
+			return Result{Outcome: OutcomeSkipped}, nil
+		}
+		return Result{Outcome: OutcomeSucceeded, From: before, To: after}, nil
+	case ActionCheckout:
+		before, after, err := checkoutPlugin(ctx, logger, client, a.URL, git.ParseRef(a.Ref), a.Path)
+		if err != nil {
+			return Result{}, err
+		}
+		if before == after {
+			logger.Debug("plugin is already at its ref", "plugin", a.Plugin, "ref", a.Ref)
+			return Result{Outcome: OutcomeSkipped}, nil
+		}
+		return Result{Outcome: OutcomeSucceeded, From: before, To: after}, nil
+	case ActionReset:
+		before, err := client.RevParse(ctx, a.Path, "HEAD")
+		if err != nil {
+			return Result{}, err
+		}
+		if before == a.Commit {
+			logger.Debug("plugin is already at the commit", "plugin", a.Plugin, "commit", a.Commit)
+			return Result{Outcome: OutcomeSkipped}, nil
+		}
+		logger.Debug("resetting plugin", "plugin", a.Plugin, "commit", a.Commit)
+		if err = client.Reset(ctx, a.Path, a.Commit); err != nil {
+			// the commit may not be fetched yet, e.g. when restoring a lock file from another machine
+			logger.Debug("fetching plugin to reset it", "plugin", a.Plugin, "error", err)
+			if fetchErr := client.Fetch(ctx, a.Path); fetchErr != nil {
+				return Result{}, errors.Join(err, fetchErr)
+			}
+			if err = client.Reset(ctx, a.Path, a.Commit); err != nil {
+				return Result{}, err
+			}
+		}
+		if err = client.SubmoduleUpdate(ctx, a.Path); err != nil {
+			return Result{}, err
+		}
+		return Result{Outcome: OutcomeSucceeded, From: before, To: a.Commit}, nil
+	case ActionRemove:
+		logger.Debug("removing plugin", "plugin", a.Plugin, "path", a.Path)
+		if err := os.RemoveAll(a.Path); err != nil {
+			return Result{}, fmt.Errorf("failed to remove "+a.Path+": %w", err)
+		}
+		return Result{Outcome: OutcomeSucceeded}, nil
+	case ActionSkip:
+		logger.Debug("skipping plugin", "plugin", a.Plugin, "reason", a.Reason)
+		return Result{Outcome: OutcomeSkipped}, nil
+	default:
+		return Result{}, fmt.Errorf("unknown action %s", a.Kind)
+	}
+}
@@ -0,0 +1,144 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/semver"
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// isInstalled determines if the plugin has a directory in the plugins directory.
+func isInstalled(plugin tmux.Plugin, files []fs.DirEntry) bool {
+	for _, file := range files {
+		if file.IsDir() && file.Name() == plugin.Repo {
+			return true
+		}
+	}
+	return false
+}
+
+// getPlugins returns the plugins declared in the tmux conf file and the files it sources. A plugin
+// declared more than once is returned once. Different plugins installed to the same directory
+// are rejected, as they would be cloned into it at the same time.
+func getPlugins(logger *slog.Logger, confPath string) ([]tmux.Plugin, error) {
+	declarations, err := tmux.FindPlugins(confPath)
+	if err != nil {
+		return nil, err
+	}
+
+	plugins := make([]tmux.Plugin, 0, len(declarations))
+	declaredAt := make(map[string]tmux.Declaration, len(declarations))
+	for _, d := range declarations {
+		logger.Debug("found plugin", "plugin", d.Plugin, "file", d.File, "line", d.Line)
+		plugin, err := d.Parse()
+		if err != nil {
+			return nil, &PluginError{Plugin: d.Plugin, Err: fmt.Errorf("%s:%d: %w", d.File, d.Line, err)}
+		}
+		if i := slices.IndexFunc(plugins, func(p tmux.Plugin) bool { return p.Repo == plugin.Repo }); i >= 0 {
+			if plugins[i] == plugin {
+				logger.Debug("plugin is declared more than once", "plugin", d.Plugin, "file", d.File, "line", d.Line)
+				continue
+			}
+			other := declaredAt[plugin.Repo]
+			return nil, &PluginError{Plugin: d.Plugin, Err: fmt.Errorf("%s:%d: %w (%s at %s:%d)", d.File, d.Line, ErrSameDirectory, other.Plugin, other.File, other.Line)}
+		}
+		declaredAt[plugin.Repo] = d
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// getConfigPath returns the path of the tmux conf file.
+func getConfigPath(ctx context.Context, logger *slog.Logger, opts Options) (string, error) {
+	var confPath string
+	var err error
+	if opts.ConfigPath != "" {
+		confPath, err = tmux.CheckConfigFile(opts.ConfigPath)
+	} else {
+		confPath, err = tmux.FindConfigFile(ctx, logger, opts.server())
+	}
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("found tmux conf file", "path", confPath)
+	return confPath, nil
+}
+
+// getPluginsDir returns the directory the plugins of the tmux conf file are installed to.
+func getPluginsDir(ctx context.Context, logger *slog.Logger, opts Options, confPath string) (string, error) {
+	if opts.PluginsDir != "" {
+		return filepath.Abs(opts.PluginsDir)
+	}
+	pluginsPath, err := tmux.PluginsDir(ctx, logger, opts.server(), confPath)
+	if err != nil {
+		return "", err
+	}
+	logger.Debug("found plugin directory", "path", pluginsPath)
+	return pluginsPath, nil
+}
+
+// readPluginsDir returns the entries of the plugins directory. If the directory does not exist,
+// there are no entries.
+func readPluginsDir(pluginsPath string) ([]fs.DirEntry, error) {
+	files, err := os.ReadDir(pluginsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+	return files, nil
+}
+
+// orphanedPlugins returns the names of the directories in the plugins directory that do not
+// belong to a configured plugin.
+func orphanedPlugins(pluginsPath string, plugins []tmux.Plugin) ([]string, error) {
+	files, err := os.ReadDir(pluginsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	configured := make(map[string]bool, len(plugins))
+	for _, p := range plugins {
+		configured[p.Repo] = true
+	}
+
+	var orphaned []string
+	for _, file := range files {
+		if file.IsDir() && !configured[file.Name()] {
+			orphaned = append(orphaned, file.Name())
+		}
+	}
+	return orphaned, nil
+}
+
+// resolveRef resolves a semver constraint to the newest tag of the remote repository at the URL
+// satisfying it. Other refs are returned as they are.
+func resolveRef(ctx context.Context, logger *slog.Logger, client git.Client, url string, ref git.Ref) (git.Ref, error) {
+	if ref.Type != git.RefSemver {
+		return ref, nil
+	}
+
+	constraint, err := semver.ParseConstraint(ref.Name)
+	if err != nil {
+		return git.Ref{}, err
+	}
+	tags, err := client.ListRemoteTags(ctx, url)
+	if err != nil {
+		return git.Ref{}, err
+	}
+	tag, ok := constraint.Latest(tags)
+	if !ok {
+		return git.Ref{}, errors.New("no tag of " + url + " satisfies " + ref.Name)
+	}
+	logger.Debug("resolved semver constraint", "url", url, "constraint", ref.Name, "tag", tag)
+	return git.Ref{Type: git.RefTag, Name: tag}, nil
+}
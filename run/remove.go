@@ -0,0 +1,116 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"slices"
+
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// Remove removes the declarations of the plugins with the names from the tmux conf file and the
+// files it sources, then removes their directories. A plugin can be selected by the name of its
+// directory, <owner>/<repo>, its URL or its declaration. Every other line of the files is kept as
+// is, and the plugins are removed from the lock file. Other directories in the plugins directory
+// are left alone.
+//
+// On a dry run, the tmux conf file is not changed and the plan to remove the plugins is returned.
+func Remove(ctx context.Context, logger *slog.Logger, opts Options, names []string) (Summary, error) {
+	logger.Debug("removing plugins", "plugins", names)
+
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		return Summary{}, err
+	}
+	declarations, err := tmux.FindPlugins(confPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var removed []tmux.Declaration
+	var removedRepos []string
+	for _, name := range names {
+		found := false
+		for _, d := range declarations {
+			plugin, err := d.Parse()
+			if err != nil || !(matchesPlugin(plugin, name) || name == d.Plugin) {
+				continue
+			}
+			found = true
+			if !slices.Contains(removed, d) {
+				removed = append(removed, d)
+				removedRepos = append(removedRepos, plugin.Repo)
+			}
+		}
+		if !found {
+			return Summary{}, &PluginError{Plugin: name, Err: ErrNotConfigured}
+		}
+	}
+	for _, d := range removed {
+		if err = tmux.CheckEditable(d.File); err != nil {
+			return Summary{}, &PluginError{Plugin: d.Plugin, Err: err}
+		}
+	}
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Summary{}, err
+	}
+	files, err := readPluginsDir(pluginsPath)
+	if err != nil {
+		return Summary{}, err
+	}
+	// a directory is kept when another declaration still installs a plugin to it
+	var kept []string
+	for _, d := range declarations {
+		if plugin, err := d.Parse(); err == nil && !slices.Contains(removed, d) {
+			kept = append(kept, plugin.Repo)
+		}
+	}
+	var plan Plan
+	for _, file := range files {
+		if file.IsDir() && slices.Contains(removedRepos, file.Name()) && !slices.Contains(kept, file.Name()) {
+			plan.Actions = append(plan.Actions, Action{Kind: ActionRemove, Plugin: file.Name(), Path: filepath.Join(pluginsPath, file.Name())})
+		}
+	}
+
+	if opts.DryRun {
+		logger.Debug("dry run, not removing plugins")
+		return Summary{Plan: plan}, nil
+	}
+
+	if err = tmux.RemovePlugins(removed); err != nil {
+		return Summary{}, err
+	}
+	for _, d := range removed {
+		logger.Debug("removed plugin", "plugin", d.Plugin, "path", d.File, "line", d.Line)
+	}
+
+	summary := plan.execute(ctx, logger, opts.git(logger), opts)
+	logger.Debug("completed removing plugins")
+	if err = removeLocked(logger, confPath, removedRepos); err != nil {
+		return summary, errors.Join(summary.Err(), err)
+	}
+	return summary, summary.Err()
+}
+
+// removeLocked removes the plugins that are no longer configured from the lock file.
+func removeLocked(logger *slog.Logger, confPath string, repos []string) error {
+	f, err := readLock(logger, confPath)
+	if err != nil || len(f.Plugins) == 0 {
+		return err
+	}
+	configured, err := getPlugins(logger, confPath)
+	if err != nil {
+		return err
+	}
+	f.Plugins = slices.DeleteFunc(f.Plugins, func(p lock.Plugin) bool {
+		return slices.Contains(repos, p.Name) && !slices.ContainsFunc(configured, func(c tmux.Plugin) bool { return c.Repo == p.Name })
+	})
+	path := lock.Path(confPath)
+	logger.Debug("writing lock file", "path", path, "plugins", len(f.Plugins))
+	return lock.Write(path, f)
+}
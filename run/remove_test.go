@@ -0,0 +1,122 @@
+package run_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/Piszmog/gtpm/run"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name            string
+		conf            string
+		plugins         []string
+		dryRun          bool
+		expectedConf    string
+		expectedRemoved []string
+		expectedErrIs   error
+	}{
+		{
+			name:    "Remove",
+			plugins: []string{"tmux-yank", "tmux-plugins/tmux-resurrect"},
+			expectedConf: `# plugins
+set -g @plugin 'tmux-plugins/tmux-sensible' # defaults
+
+run 'gtpm source'
+`,
+			expectedRemoved: []string{"tmux-yank", "tmux-resurrect"},
+		},
+		{
+			name:            "Dry Run",
+			plugins:         []string{yankURL},
+			dryRun:          true,
+			expectedRemoved: []string{"tmux-yank"},
+		},
+		{
+			name:    "Last Plugin",
+			conf:    "set -g @plugin 'tmux-plugins/tmux-yank'\nrun 'gtpm source'\n",
+			plugins: []string{"tmux-yank"},
+			expectedConf: `run 'gtpm source'
+`,
+			expectedRemoved: []string{"tmux-yank"},
+		},
+		{
+			name:          "Not Configured",
+			plugins:       []string{"tmux-yank", "tmux-continuum"},
+			expectedErrIs: run.ErrNotConfigured,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := test.conf
+			if conf == "" {
+				conf = `# plugins
+set -g @plugin 'tmux-plugins/tmux-sensible' # defaults
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-resurrect#main'
+
+run 'gtpm source'
+`
+			}
+			dir := setupConfig(t, conf)
+			confPath := filepath.Join(dir, "tmux.conf")
+			pluginsPath := filepath.Join(dir, "plugins")
+			plugins := []string{"tmux-sensible", "tmux-yank", "tmux-resurrect"}
+			// my-local-thing is not managed by gtpm, so it is never removed
+			for _, name := range append(plugins, "my-local-thing") {
+				require.NoError(t, os.MkdirAll(filepath.Join(pluginsPath, name), os.ModePerm))
+			}
+			locked := lock.File{}
+			for _, name := range plugins {
+				locked.Plugins = append(locked.Plugins, lock.Plugin{Name: name, Commit: "c1"})
+			}
+			require.NoError(t, lock.Write(lock.Path(confPath), locked))
+
+			summary, err := run.Remove(context.Background(), logger, run.Options{Git: newFake(), DryRun: test.dryRun}, test.plugins)
+			actual, readErr := os.ReadFile(confPath)
+			require.NoError(t, readErr)
+			if test.expectedErrIs != nil {
+				require.ErrorIs(t, err, test.expectedErrIs)
+				assert.Equal(t, conf, string(actual))
+				return
+			}
+			require.NoError(t, err)
+
+			var removed []string
+			for _, a := range summary.Plan.Actions {
+				assert.Equal(t, run.ActionRemove, a.Kind)
+				removed = append(removed, a.Plugin)
+			}
+			assert.ElementsMatch(t, test.expectedRemoved, removed)
+
+			if test.dryRun {
+				assert.Equal(t, conf, string(actual))
+				assert.DirExists(t, filepath.Join(pluginsPath, "tmux-yank"))
+				return
+			}
+			assert.Equal(t, test.expectedConf, string(actual))
+			for _, name := range test.expectedRemoved {
+				assert.NoDirExists(t, filepath.Join(pluginsPath, name))
+			}
+			assert.DirExists(t, filepath.Join(pluginsPath, "tmux-sensible"))
+			assert.DirExists(t, filepath.Join(pluginsPath, "my-local-thing"))
+			f, err := lock.Read(lock.Path(confPath))
+			require.NoError(t, err)
+			var names []string
+			for _, p := range f.Plugins {
+				names = append(names, p.Name)
+			}
+			for _, name := range test.expectedRemoved {
+				assert.NotContains(t, names, name)
+			}
+			assert.Contains(t, names, "tmux-sensible")
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package run
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Report is the machine-readable result of a command. It is written to stdout when the output
+// is JSON, while the logs are written to stderr.
+type Report struct {
+	Command string  `json:"command"`
+	Outcome Outcome `json:"outcome"`
+	// DryRun is when the actions in Plan were only planned.
+	DryRun bool `json:"dry_run,omitempty"`
+	// DurationMS is how long the command took in milliseconds.
+	DurationMS int64 `json:"duration_ms"`
+	// Plugins are the plugins the command acted on. Commands that do not act on plugins (e.g.
+	// list) leave it empty and set Data instead.
+	Plugins []PluginReport `json:"plugins"`
+	// Plan is the actions that would be performed. It is only set on a dry run.
+	Plan *Plan `json:"plan,omitempty"`
+	// Data is the output specific to the command (e.g. the changelog of update or the status of
+	// list).
+	Data any `json:"data,omitempty"`
+	// Error is the error the command failed with.
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// PluginReport is the outcome of the action performed on a plugin.
+type PluginReport struct {
+	Plugin  string     `json:"plugin"`
+	Action  ActionKind `json:"action"`
+	Outcome Outcome    `json:"outcome"`
+	// From and To are the commits the plugin moved between.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// DurationMS is how long the action took in milliseconds.
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewReport creates the report of the command from the summary of the actions it performed,
+// how long it took and the error it failed with.
+func NewReport(command string, summary Summary, duration time.Duration, err error) Report {
+	r := Report{
+		Command:    command,
+		Outcome:    OutcomeSucceeded,
+		DurationMS: duration.Milliseconds(),
+		Plugins:    []PluginReport{},
+	}
+	if summary.Results == nil && len(summary.Plan.Actions) > 0 {
+		r.DryRun = true
+		r.Plan = &summary.Plan
+	}
+	for i, res := range summary.Results {
+		p := PluginReport{
+			Plugin:     res.Plugin,
+			Outcome:    res.Outcome,
+			From:       res.From,
+			To:         res.To,
+			DurationMS: res.Duration.Milliseconds(),
+		}
+		if i < len(summary.Plan.Actions) {
+			p.Action = summary.Plan.Actions[i].Kind
+		}
+		if res.Err != nil {
+			p.Error = res.Err.Error()
+		}
+		r.Plugins = append(r.Plugins, p)
+	}
+	if len(summary.Changelog.Changes) > 0 {
+		r.Data = summary.Changelog
+	}
+	if err != nil {
+		r.Outcome = OutcomeFailed
+		r.Error = err.Error()
+		r.ExitCode = ExitCode(err)
+	}
+	return r
+}
+
+// Write writes the report as a JSON object to w.
+func (r Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
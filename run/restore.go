@@ -0,0 +1,92 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// Restore checks out every configured plugin at the commit recorded in the lock file. Plugins
+// that are not installed yet are cloned first, and plugins that are not in the lock file are
+// skipped.
+//
+// A failure to restore one plugin does not stop the others from being restored. The outcome
+// of every plugin is returned in the summary, and the error contains all the plugins that failed.
+func Restore(ctx context.Context, logger *slog.Logger, opts Options) (Summary, error) {
+	logger.Debug("restoring plugins")
+
+	client := opts.git(logger)
+
+	logger.Debug("checking if git is install")
+	if !client.IsInstalled(ctx) {
+		return Summary{}, fmt.Errorf("%w to restore plugins", ErrGitNotInstalled)
+	}
+
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	lockPath := lock.Path(confPath)
+	lockFile, err := lock.Read(lockPath)
+	if err != nil {
+		if errors.Is(err, lock.ErrNotFound) {
+			return Summary{}, errors.New("cannot restore plugins, " + lockPath + " does not exist (run install or update to create it)")
+		}
+		return Summary{}, err
+	}
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	plugins, err := getPlugins(logger, confPath)
+	if err != nil {
+		return Summary{}, err
+	}
+	files, err := readPluginsDir(pluginsPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var plan Plan
+	for _, plugin := range plugins {
+		path := filepath.Join(pluginsPath, plugin.Repo)
+		commit, ok := lockedCommit(lockFile, plugin)
+		switch {
+		case !ok:
+			logger.Warn("plugin is not in the lock file, skipping", "plugin", plugin.Repo)
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Plugin: plugin.Repo, Path: path, Reason: "not in the lock file"})
+		case isInstalled(plugin, files):
+			plan.Actions = append(plan.Actions, Action{Kind: ActionReset, Plugin: plugin.Repo, URL: plugin.URL, Commit: commit, Path: path})
+		default:
+			plan.Actions = append(plan.Actions, Action{
+				Kind:   ActionClone,
+				Plugin: plugin.Repo,
+				URL:    plugin.URL,
+				Ref:    plugin.Ref.String(),
+				Commit: commit,
+				Path:   path,
+			})
+		}
+	}
+
+	if opts.DryRun {
+		logger.Debug("dry run, not restoring plugins")
+		return Summary{Plan: plan}, nil
+	}
+	if err = tmux.CreatePluginsDir(pluginsPath); err != nil {
+		return Summary{}, err
+	}
+
+	summary := plan.execute(ctx, logger, client, opts)
+	logger.Debug("completed restoring plugins")
+
+	return summary, summary.Err()
+}
@@ -0,0 +1,138 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Piszmog/gtpm/history"
+)
+
+// Rollback resets the plugins with the names, or every plugin when no names are given, to the
+// commit they were at before the last steps updates recorded in the history file. The lock file
+// is updated afterwards and, when running inside tmux, the plugins that were reset are sourced
+// again.
+//
+// Rolling back does not change the history, so rolling back again with the same steps does
+// nothing.
+func Rollback(ctx context.Context, logger *slog.Logger, opts Options, plugins []string, steps int) (Summary, error) {
+	if steps < 1 {
+		steps = 1
+	}
+	logger.Debug("rolling back plugins", "plugins", plugins, "steps", steps)
+
+	client := opts.git(logger)
+
+	logger.Debug("checking if git is install")
+	if !client.IsInstalled(ctx) {
+		return Summary{}, fmt.Errorf("%w to roll back plugins", ErrGitNotInstalled)
+	}
+
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	configuredPlugins, err := getPlugins(logger, confPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	pluginsToRollback := configuredPlugins
+	if len(plugins) > 0 {
+		if pluginsToRollback, err = selectPlugins(configuredPlugins, plugins); err != nil {
+			return Summary{}, err
+		}
+	}
+
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	historyPath := history.Path(confPath, pluginsPath)
+	logger.Debug("reading history file", "path", historyPath)
+	historyFile, err := history.Read(historyPath)
+	if err != nil {
+		return Summary{}, err
+	}
+	if len(historyFile.Updates) == 0 {
+		return Summary{}, errors.New("no update has changed a plugin yet, there is nothing to roll back")
+	}
+	if steps > len(historyFile.Updates) {
+		return Summary{}, errors.New("cannot roll back " + strconv.Itoa(steps) + " updates, only " + strconv.Itoa(len(historyFile.Updates)) + " are recorded")
+	}
+	updates := historyFile.Updates[len(historyFile.Updates)-steps:]
+
+	files, err := readPluginsDir(pluginsPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var plan Plan
+	for _, plugin := range pluginsToRollback {
+		path := filepath.Join(pluginsPath, plugin.Repo)
+		commit, ok := commitBefore(updates, plugin.Repo)
+		switch {
+		case !ok:
+			if len(plugins) > 0 {
+				plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Plugin: plugin.Repo, Path: path, Reason: "not changed by the rolled back updates"})
+			}
+		case !isInstalled(plugin, files):
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Plugin: plugin.Repo, Path: path, Reason: "not installed"})
+		default:
+			plan.Actions = append(plan.Actions, Action{
+				Kind:   ActionReset,
+				Plugin: plugin.Repo,
+				URL:    plugin.URL,
+				Commit: commit,
+				Path:   path,
+			})
+		}
+	}
+
+	if opts.DryRun {
+		logger.Debug("dry run, not rolling back plugins")
+		return Summary{Plan: plan}, nil
+	}
+
+	summary := plan.execute(ctx, logger, client, opts)
+
+	if err = updateLock(ctx, logger, client, confPath, pluginsPath, configuredPlugins, summary); err != nil {
+		return summary, err
+	}
+
+	if os.Getenv("TMUX") == "" {
+		logger.Debug("not running inside tmux, not sourcing plugins")
+		return summary, summary.Err()
+	}
+	errs := []error{summary.Err()}
+	for i, r := range summary.Results {
+		if r.Outcome != OutcomeSucceeded {
+			continue
+		}
+		logger.Debug("sourcing plugin", "plugin", r.Plugin)
+		if err = sourcePluginWithTimeout(ctx, logger, opts, plan.Actions[i].Path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return summary, errors.Join(errs...)
+}
+
+// commitBefore returns the commit the plugin was at before the first of the updates that changed
+// it.
+func commitBefore(updates []history.Update, plugin string) (string, bool) {
+	for _, u := range updates {
+		for _, c := range u.Changes {
+			if c.Plugin == plugin {
+				return c.From, true
+			}
+		}
+	}
+	return "", false
+}
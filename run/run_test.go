@@ -0,0 +1,1379 @@
+package run_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/git/gittest"
+	"github.com/Piszmog/gtpm/history"
+	"github.com/Piszmog/gtpm/lock"
+	"github.com/Piszmog/gtpm/run"
+	"github.com/Piszmog/gtpm/state"
+	"github.com/Piszmog/gtpm/tmux/tmuxtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sensibleURL  = "https://git::@github.com/tmux-plugins/tmux-sensible"
+	yankURL      = "https://git::@github.com/tmux-plugins/tmux-yank"
+	resurrectURL = "https://git::@github.com/tmux-plugins/tmux-resurrect"
+	continuumURL = "https://git::@github.com/tmux-plugins/tmux-continuum"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// setupConfig writes the tmux conf file to a temporary $XDG_CONFIG_HOME and returns the
+// directory the tmux conf file is in. $XDG_STATE_HOME is also set to a temporary directory, and
+// $TMUX and $TMUX_PLUGIN_MANAGER_PATH are cleared so nothing assumes it runs inside tmux.
+func setupConfig(t *testing.T, conf string) string {
+	t.Helper()
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("TMUX", "")
+	t.Setenv("TMUX_PLUGIN_MANAGER_PATH", "")
+
+	dir := filepath.Join(configHome, "tmux")
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tmux.conf"), []byte(conf), 0o644))
+	return dir
+}
+
+func newFake() *gittest.Fake {
+	fake := gittest.NewFake()
+	fake.AddRemote(sensibleURL, "main", "s1", "s2")
+	fake.AddRemote(yankURL, "main", "y1")
+	return fake
+}
+
+// results returns the results of the summary without their durations, which differ on every run.
+func results(summary run.Summary) []run.Result {
+	var r []run.Result
+	for _, result := range summary.Results {
+		result.Duration = 0
+		r = append(r, result)
+	}
+	return r
+}
+
+func TestInstall(t *testing.T) {
+	tests := []struct {
+		name             string
+		opts             run.Options
+		lock             *lock.File
+		installed        []string
+		failClone        string
+		failReset        string
+		expectedResults  []run.Result
+		expectedHeads    map[string]string
+		expectedErr      string
+		expectedLockFile *lock.File
+	}{
+		{
+			name: "Install All",
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s2", "tmux-yank": "y1"},
+			expectedLockFile: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s2"},
+				{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+			}},
+		},
+		{
+			name:      "Skip Installed",
+			installed: []string{"tmux-sensible"},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSkipped},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s2", "tmux-yank": "y1"},
+		},
+		{
+			name:      "Keep Lock Of Skipped",
+			installed: []string{"tmux-sensible"},
+			lock: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+			}},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSkipped},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s2", "tmux-yank": "y1"},
+			expectedLockFile: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+				{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+			}},
+		},
+		{
+			name: "Honor Lock",
+			lock: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+			}},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s1", "tmux-yank": "y1"},
+		},
+		{
+			name: "Ignore Lock",
+			opts: run.Options{IgnoreLock: true},
+			lock: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+			}},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s2", "tmux-yank": "y1"},
+		},
+		{
+			name:      "Failure Does Not Stop Others",
+			opts:      run.Options{Jobs: 2},
+			failClone: sensibleURL,
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeFailed, Err: errors.New("auth failed")},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "", "tmux-yank": "y1"},
+			expectedErr:   "plugin tmux-sensible: auth failed",
+			expectedLockFile: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+			}},
+		},
+		{
+			name: "Keep Clone When Locked Commit Fails",
+			lock: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+			}},
+			failReset: "tmux-sensible",
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeFailed, Err: &run.PluginError{
+					Plugin: "tmux-sensible",
+					Err:    fmt.Errorf("failed to check out locked commit s1: %w", errors.New("bad object")),
+				}},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s2", "tmux-yank": "y1"},
+			expectedErr:   "plugin tmux-sensible: failed to check out locked commit s1: bad object",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+`)
+			pluginsPath := filepath.Join(dir, "plugins")
+			fake := newFake()
+			for _, name := range test.installed {
+				require.NoError(t, fake.Clone(context.Background(), "https://git::@github.com/tmux-plugins/"+name, git.Ref{}, filepath.Join(pluginsPath, name), nil))
+			}
+			if test.lock != nil {
+				require.NoError(t, lock.Write(filepath.Join(dir, lock.FileName), *test.lock))
+			}
+			if test.failClone != "" {
+				fake.FailOn("Clone", test.failClone, errors.New("auth failed"))
+			}
+			if test.failReset != "" {
+				fake.FailOn("Reset", filepath.Join(pluginsPath, test.failReset), errors.New("bad object"))
+			}
+
+			opts := test.opts
+			opts.Git = fake
+			summary, err := run.Install(context.Background(), logger, opts)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, test.expectedErr, err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedResults, results(summary))
+
+			for name, head := range test.expectedHeads {
+				assert.Equal(t, head, fake.Head(filepath.Join(pluginsPath, name)), name)
+			}
+
+			if test.expectedLockFile != nil {
+				lockFile, err := lock.Read(filepath.Join(dir, lock.FileName))
+				require.NoError(t, err)
+				assert.Equal(t, *test.expectedLockFile, lockFile)
+			}
+		})
+	}
+}
+
+func TestInstall_DryRun(t *testing.T) {
+	dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+	fake := newFake()
+
+	summary, err := run.Install(context.Background(), logger, run.Options{DryRun: true, Git: fake})
+	require.NoError(t, err)
+	assert.Empty(t, summary.Results)
+	assert.Equal(t, []run.Action{
+		{
+			Kind:   run.ActionClone,
+			Plugin: "tmux-sensible",
+			URL:    sensibleURL,
+			Path:   filepath.Join(dir, "plugins", "tmux-sensible"),
+		},
+	}, summary.Plan.Actions)
+
+	assert.NoDirExists(t, filepath.Join(dir, "plugins"))
+	assert.NoFileExists(t, filepath.Join(dir, lock.FileName))
+	for _, call := range fake.Calls() {
+		assert.NotEqual(t, "Clone", call.Method)
+	}
+}
+
+func TestInstall_PluginsDir(t *testing.T) {
+	tests := []struct {
+		name        string
+		conf        string
+		env         string
+		tmuxEnv     string
+		expectedDir func(dir string) string
+	}{
+		{
+			name: "Option",
+			conf: `
+set -g @gtpm-plugin-dir 'custom'
+set-environment -g TMUX_PLUGIN_MANAGER_PATH '/ignored/'
+`,
+			env:         "/ignored",
+			expectedDir: func(dir string) string { return filepath.Join(dir, "custom") },
+		},
+		{
+			name:        "Environment",
+			env:         "~/env-plugins/",
+			tmuxEnv:     "/ignored",
+			expectedDir: func(dir string) string { return filepath.Join(os.Getenv("HOME"), "env-plugins") },
+		},
+		{
+			name:        "Tmux Environment",
+			tmuxEnv:     "tmux-plugins/",
+			expectedDir: func(dir string) string { return filepath.Join(dir, "tmux-plugins") },
+		},
+		{
+			name:        "Conf File Environment",
+			conf:        `set-environment -g TMUX_PLUGIN_MANAGER_PATH 'conf-plugins/'`,
+			expectedDir: func(dir string) string { return filepath.Join(dir, "conf-plugins") },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, test.conf+"\nset -g @plugin 'tmux-plugins/tmux-sensible'\n")
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("TMUX_PLUGIN_MANAGER_PATH", test.env)
+			tmuxClient := tmuxtest.NewFake()
+			if test.tmuxEnv != "" {
+				tmuxClient.Environment["TMUX_PLUGIN_MANAGER_PATH"] = test.tmuxEnv
+			}
+
+			summary, err := run.Install(context.Background(), logger, run.Options{Git: newFake(), Tmux: tmuxClient})
+			require.NoError(t, err)
+			assert.Equal(t, 1, summary.Count(run.OutcomeSucceeded))
+			assert.DirExists(t, filepath.Join(test.expectedDir(dir), "tmux-sensible"))
+			assert.NoDirExists(t, filepath.Join(dir, "plugins"))
+		})
+	}
+}
+
+func TestInstall_ConfigPath(t *testing.T) {
+	confDir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-yank'`)
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "tmux.conf")
+	require.NoError(t, os.WriteFile(confPath, []byte(`set -g @plugin 'tmux-plugins/tmux-sensible'`), 0o644))
+	pluginsPath := filepath.Join(dir, "cache", "plugins")
+
+	summary, err := run.Install(context.Background(), logger, run.Options{Git: newFake(), ConfigPath: confPath, PluginsDir: pluginsPath})
+	require.NoError(t, err)
+	assert.Equal(t, []run.Result{{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded}}, results(summary))
+	assert.DirExists(t, filepath.Join(pluginsPath, "tmux-sensible"))
+	assert.FileExists(t, filepath.Join(dir, lock.FileName))
+	assert.NoDirExists(t, filepath.Join(confDir, "plugins"))
+
+	_, err = run.Install(context.Background(), logger, run.Options{Git: newFake(), ConfigPath: filepath.Join(dir, "missing.conf")})
+	require.ErrorContains(t, err, "missing.conf does not exist")
+}
+
+func TestInstall_GitNotInstalled(t *testing.T) {
+	setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+	fake := newFake()
+	fake.NotInstalled = true
+
+	_, err := run.Install(context.Background(), logger, run.Options{Git: fake})
+	require.Error(t, err)
+	assert.Equal(t, "git is required to install plugins", err.Error())
+	assert.ErrorIs(t, err, run.ErrGitNotInstalled)
+}
+
+// recorder is a run.Observer recording every event it is sent.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) PluginStarted(plugin string, action run.ActionKind) {
+	r.record("started " + plugin + " " + string(action))
+}
+
+func (r *recorder) CloneProgress(plugin string, progress git.CloneProgress) {
+	r.record(fmt.Sprintf("progress %s %s %d%%", plugin, progress.Phase, progress.Percent))
+}
+
+func (r *recorder) PluginDone(plugin string, action run.ActionKind, result run.Result) {
+	r.record("done " + plugin + " " + string(action) + " " + string(result.Outcome))
+}
+
+func (r *recorder) PluginFailed(plugin string, action run.ActionKind, err error) {
+	r.record("failed " + plugin + " " + string(action))
+}
+
+func TestObserver(t *testing.T) {
+	tests := []struct {
+		name           string
+		run            func(opts run.Options) error
+		expectedEvents []string
+	}{
+		{
+			name: "Install",
+			run: func(opts run.Options) error {
+				_, err := run.Install(context.Background(), logger, opts)
+				return err
+			},
+			expectedEvents: []string{
+				"started tmux-yank clone",
+				"progress tmux-yank Receiving objects 100%",
+				"done tmux-yank clone succeeded",
+				"started tmux-copycat clone",
+				"failed tmux-copycat clone",
+				"started tmux-sensible skip",
+				"done tmux-sensible skip skipped",
+			},
+		},
+		{
+			name: "Update",
+			run: func(opts run.Options) error {
+				_, err := run.Update(context.Background(), logger, opts, nil)
+				return err
+			},
+			expectedEvents: []string{
+				"started tmux-sensible pull",
+				"done tmux-sensible pull succeeded",
+				"started tmux-yank skip",
+				"done tmux-yank skip skipped",
+				"started tmux-copycat skip",
+				"done tmux-copycat skip skipped",
+			},
+		},
+		{
+			name: "Clean",
+			run: func(opts run.Options) error {
+				_, err := run.Clean(context.Background(), logger, opts)
+				return err
+			},
+			expectedEvents: []string{
+				"started tmux-sensible-old remove",
+				"done tmux-sensible-old remove succeeded",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-copycat'
+`)
+			pluginsPath := filepath.Join(dir, "plugins")
+			fake := newFake()
+			require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+			require.NoError(t, os.MkdirAll(filepath.Join(pluginsPath, "tmux-sensible-old"), os.ModePerm))
+			fake.Push(sensibleURL, "main", "s3")
+
+			observer := &recorder{}
+			_ = test.run(run.Options{Git: fake, Observer: observer})
+			assert.ElementsMatch(t, test.expectedEvents, observer.events)
+		})
+	}
+}
+
+func TestInstall_Canceled(t *testing.T) {
+	dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	summary, err := run.Install(ctx, logger, run.Options{Git: newFake()})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, run.ExitCodeCanceled, run.ExitCode(err))
+	assert.Equal(t, 2, summary.Count(run.OutcomeFailed))
+	assert.NoDirExists(t, filepath.Join(dir, "plugins", "tmux-sensible"))
+	assert.NoDirExists(t, filepath.Join(dir, "plugins", "tmux-yank"))
+}
+
+func TestInstall_Timeout(t *testing.T) {
+	dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+	fake := newFake()
+	fake.CloneDelay = time.Minute
+
+	_, err := run.Install(context.Background(), logger, run.Options{Git: fake, Timeout: 10 * time.Millisecond})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, run.ExitCodeTimeout, run.ExitCode(err))
+	assert.Contains(t, err.Error(), "plugin tmux-sensible: timed out after 10ms")
+	// the directory git left behind is removed
+	assert.NoDirExists(t, filepath.Join(dir, "plugins", "tmux-sensible"))
+}
+
+func TestInstall_RemoteNotFound(t *testing.T) {
+	setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-copycat'
+`)
+	fake := newFake()
+
+	summary, err := run.Install(context.Background(), logger, run.Options{Git: fake})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, git.ErrRemoteNotFound)
+	assert.Equal(t, run.ExitCodeRemoteNotFound, run.ExitCode(err))
+
+	var pluginErr *run.PluginError
+	require.ErrorAs(t, err, &pluginErr)
+	assert.Equal(t, "tmux-copycat", pluginErr.Plugin)
+	assert.Equal(t, run.OutcomeSucceeded, summary.Results[0].Outcome)
+	assert.Equal(t, run.OutcomeFailed, summary.Results[1].Outcome)
+}
+
+// blockingGit is a git client whose clones wait until jobs clones are running at the same time,
+// so a test can check that no more than jobs ever run at once.
+type blockingGit struct {
+	*gittest.Fake
+	jobs int
+	// slow are the URLs whose clones take longer than the others, so they finish last.
+	slow []string
+
+	mu      sync.Mutex
+	running int
+	max     int
+	once    sync.Once
+	full    chan struct{}
+}
+
+func (g *blockingGit) Clone(ctx context.Context, url string, ref git.Ref, targetDir string, progress func(git.CloneProgress)) error {
+	g.mu.Lock()
+	g.running++
+	g.max = max(g.max, g.running)
+	if g.running == g.jobs {
+		g.once.Do(func() { close(g.full) })
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-g.full:
+	case <-time.After(time.Second):
+	}
+	if slices.Contains(g.slow, url) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	err := g.Fake.Clone(ctx, url, ref, targetDir, progress)
+
+	g.mu.Lock()
+	g.running--
+	g.mu.Unlock()
+	return err
+}
+
+func TestInstall_Jobs(t *testing.T) {
+	setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+set -g @plugin 'tmux-plugins/tmux-continuum'
+`)
+	fake := newFake()
+	fake.AddRemote(resurrectURL, "main", "r1")
+	fake.AddRemote(continuumURL, "main", "c1")
+	client := &blockingGit{Fake: fake, jobs: 2, slow: []string{sensibleURL}, full: make(chan struct{})}
+
+	summary, err := run.Install(context.Background(), logger, run.Options{Git: client, Jobs: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, client.max)
+	// the results are in the order of the plan, not the order the clones finished in
+	assert.Equal(t, []run.Result{
+		{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded},
+		{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+		{Plugin: "tmux-resurrect", Outcome: run.OutcomeSucceeded},
+		{Plugin: "tmux-continuum", Outcome: run.OutcomeSucceeded},
+	}, results(summary))
+}
+
+func TestInstall_SameDirectory(t *testing.T) {
+	dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'someone/tmux-yank'
+`)
+	fake := newFake()
+
+	_, err := run.Install(context.Background(), logger, run.Options{Git: fake})
+	require.ErrorIs(t, err, run.ErrSameDirectory)
+	confPath := filepath.Join(dir, "tmux.conf")
+	assert.Equal(t, fmt.Sprintf("plugin someone/tmux-yank: %s:4: installs to the same directory as another plugin (tmux-plugins/tmux-yank at %s:2)", confPath, confPath), err.Error())
+	assert.Empty(t, fake.Calls())
+}
+
+func TestUpdate(t *testing.T) {
+	dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+	pluginPath := filepath.Join(dir, "plugins", "tmux-sensible")
+	fake := newFake()
+	require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, pluginPath, nil))
+
+	summary, err := run.Update(context.Background(), logger, run.Options{Git: fake}, []string{"tmux-sensible"})
+	require.NoError(t, err)
+	assert.Equal(t, []run.Result{{Plugin: "tmux-sensible", Outcome: run.OutcomeSkipped}}, results(summary))
+
+	fake.Push(sensibleURL, "main", "s3")
+
+	summary, err = run.Update(context.Background(), logger, run.Options{DryRun: true, Git: fake}, []string{"tmux-sensible"})
+	require.NoError(t, err)
+	assert.Equal(t, []run.Action{
+		{Kind: run.ActionPull, Plugin: "tmux-sensible", URL: sensibleURL, Path: pluginPath},
+	}, summary.Plan.Actions)
+	assert.Equal(t, "s2", fake.Head(pluginPath))
+
+	summary, err = run.Update(context.Background(), logger, run.Options{Git: fake}, []string{"tmux-sensible"})
+	require.NoError(t, err)
+	assert.Equal(t, []run.Result{{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded, From: "s2", To: "s3"}}, results(summary))
+	assert.Equal(t, "s3", fake.Head(pluginPath))
+
+	lockFile, err := lock.Read(filepath.Join(dir, lock.FileName))
+	require.NoError(t, err)
+	assert.Equal(t, lock.File{Plugins: []lock.Plugin{{Name: "tmux-sensible", URL: sensibleURL, Commit: "s3"}}}, lockFile)
+}
+
+func TestUpdate_KeepLockOfNotInstalled(t *testing.T) {
+	dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+`)
+	pluginPath := filepath.Join(dir, "plugins", "tmux-sensible")
+	fake := newFake()
+	require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, pluginPath, nil))
+	require.NoError(t, lock.Write(filepath.Join(dir, lock.FileName), lock.File{Plugins: []lock.Plugin{
+		{Name: "tmux-sensible", URL: sensibleURL, Commit: "s2"},
+		{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+		{Name: "tmux-removed", URL: "https://git::@github.com/someone/tmux-removed", Commit: "x1"},
+	}}))
+
+	fake.Push(sensibleURL, "main", "s3")
+	_, err := run.Update(context.Background(), logger, run.Options{Git: fake}, []string{"tmux-sensible"})
+	require.NoError(t, err)
+
+	lockFile, err := lock.Read(filepath.Join(dir, lock.FileName))
+	require.NoError(t, err)
+	assert.Equal(t, lock.File{Plugins: []lock.Plugin{
+		{Name: "tmux-sensible", URL: sensibleURL, Commit: "s3"},
+		{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+	}}, lockFile)
+}
+
+func TestUpdate_Changelog(t *testing.T) {
+	dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+`)
+	pluginsPath := filepath.Join(dir, "plugins")
+	fake := newFake()
+	require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+	require.NoError(t, fake.Clone(context.Background(), yankURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-yank"), nil))
+
+	_, err := run.LastChangelog(context.Background(), logger, run.Options{Git: fake})
+	require.Error(t, err)
+	assert.Equal(t, "no update has changed a plugin yet", err.Error())
+
+	fake.Push(sensibleURL, "main", "s3", "s4")
+	summary, err := run.Update(context.Background(), logger, run.Options{Git: fake}, nil)
+	require.NoError(t, err)
+	expectedChanges := []history.Change{
+		{
+			Plugin:  "tmux-sensible",
+			URL:     sensibleURL,
+			From:    "s2",
+			To:      "s4",
+			Commits: []git.Commit{{SHA: "s4", Subject: "subject of s4"}, {SHA: "s3", Subject: "subject of s3"}},
+		},
+	}
+	assert.Equal(t, expectedChanges, summary.Changelog.Changes)
+
+	// an update without changes does not replace the last changelog
+	summary, err = run.Update(context.Background(), logger, run.Options{Git: fake}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, summary.Changelog.Changes)
+
+	changelog, err := run.LastChangelog(context.Background(), logger, run.Options{Git: fake})
+	require.NoError(t, err)
+	assert.Equal(t, expectedChanges, changelog.Changes)
+
+	// the history is kept per tmux conf file and plugins directory
+	_, err = run.LastChangelog(context.Background(), logger, run.Options{Git: fake, PluginsDir: t.TempDir()})
+	require.Error(t, err)
+	assert.Equal(t, "no update has changed a plugin yet", err.Error())
+
+	var out strings.Builder
+	require.NoError(t, changelog.Print(&out, run.FormatTable))
+	assert.Equal(t, "tmux-sensible s2 -> s4 (2 commits)\n  s4 subject of s4\n  s3 subject of s3\n", out.String())
+}
+
+func TestUpdate_Conflict(t *testing.T) {
+	dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+	pluginPath := filepath.Join(dir, "plugins", "tmux-sensible")
+	fake := newFake()
+	require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, pluginPath, nil))
+	fake.Commit(pluginPath, "local")
+	fake.Push(sensibleURL, "main", "s3")
+
+	summary, err := run.Update(context.Background(), logger, run.Options{Git: fake}, nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, git.ErrConflict)
+	assert.Equal(t, run.ExitCodeConflict, run.ExitCode(err))
+	assert.Equal(t, run.OutcomeFailed, summary.Results[0].Outcome)
+	assert.Equal(t, "local", fake.Head(pluginPath))
+}
+
+func TestNewReport(t *testing.T) {
+	setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-copycat'
+`)
+	summary, err := run.Install(context.Background(), logger, run.Options{Git: newFake()})
+	require.Error(t, err)
+
+	report := run.NewReport("install", summary, 1500*time.Millisecond, err)
+	for i := range report.Plugins {
+		report.Plugins[i].DurationMS = 0
+	}
+	assert.Equal(t, run.Report{
+		Command:    "install",
+		Outcome:    run.OutcomeFailed,
+		DurationMS: 1500,
+		Plugins: []run.PluginReport{
+			{Plugin: "tmux-sensible", Action: run.ActionClone, Outcome: run.OutcomeSucceeded},
+			{Plugin: "tmux-copycat", Action: run.ActionClone, Outcome: run.OutcomeFailed, Error: summary.Results[1].Err.Error()},
+		},
+		Error:    err.Error(),
+		ExitCode: run.ExitCodeRemoteNotFound,
+	}, report)
+
+	var out strings.Builder
+	require.NoError(t, report.Write(&out))
+	assert.Contains(t, out.String(), `"exit_code": 7`)
+}
+
+func TestNewReport_DryRun(t *testing.T) {
+	setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+	summary, err := run.Install(context.Background(), logger, run.Options{Git: newFake(), DryRun: true})
+	require.NoError(t, err)
+
+	report := run.NewReport("install", summary, 0, nil)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, &summary.Plan, report.Plan)
+	assert.Empty(t, report.Plugins)
+	assert.Equal(t, run.OutcomeSucceeded, report.Outcome)
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{
+			name:     "No Error",
+			expected: 0,
+		},
+		{
+			name:     "Unknown",
+			err:      errors.New("failed"),
+			expected: run.ExitCodeError,
+		},
+		{
+			name:     "Git Not Installed",
+			err:      fmt.Errorf("%w to install plugins", run.ErrGitNotInstalled),
+			expected: run.ExitCodeGitNotInstalled,
+		},
+		{
+			name:     "Plugin Not Installed",
+			err:      &run.PluginError{Plugin: "tmux-sensible", Err: run.ErrNotInstalled},
+			expected: run.ExitCodeNotInstalled,
+		},
+		{
+			name:     "Auth Failed",
+			err:      &run.PluginError{Plugin: "tmux-sensible", Err: &git.Error{Op: "clone", Target: sensibleURL, Err: git.ErrAuthFailed}},
+			expected: run.ExitCodeAuthFailed,
+		},
+		{
+			name:     "Multiple Entrypoints",
+			err:      &run.PluginError{Plugin: "tmux-sensible", Err: run.ErrMultipleEntrypoints},
+			expected: run.ExitCodeMultipleEntrypoints,
+		},
+		{
+			name:     "Timeout",
+			err:      &run.PluginError{Plugin: "tmux-sensible", Err: fmt.Errorf("timed out after 5m0s: %w", context.DeadlineExceeded)},
+			expected: run.ExitCodeTimeout,
+		},
+		{
+			name:     "Canceled",
+			err:      &run.PluginError{Plugin: "tmux-sensible", Err: &git.Error{Op: "clone", Target: sensibleURL, Err: context.Canceled}},
+			expected: run.ExitCodeCanceled,
+		},
+		{
+			name: "Joined",
+			err: errors.Join(
+				&run.PluginError{Plugin: "tmux-sensible", Err: run.ErrNoEntrypoint},
+				&run.PluginError{Plugin: "tmux-yank", Err: &git.Error{Op: "fast-forward", Target: "tmux-yank", Err: git.ErrConflict}},
+			),
+			expected: run.ExitCodeConflict,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, run.ExitCode(test.err))
+		})
+	}
+}
+
+func TestUpdate_Pinned(t *testing.T) {
+	tests := []struct {
+		name           string
+		ref            string
+		expectedResult run.Result
+		expectedHead   string
+	}{
+		{
+			name:           "Tag",
+			ref:            "v1.0.0",
+			expectedResult: run.Result{Plugin: "tmux-sensible", Outcome: run.OutcomeSkipped},
+			expectedHead:   "c0ffee1",
+		},
+		{
+			name:           "Commit",
+			ref:            "c0ffee1",
+			expectedResult: run.Result{Plugin: "tmux-sensible", Outcome: run.OutcomeSkipped},
+			expectedHead:   "c0ffee1",
+		},
+		{
+			name:           "Semver",
+			ref:            "^1.0",
+			expectedResult: run.Result{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded, From: "s2", To: "s3"},
+			expectedHead:   "s3",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, "set -g @plugin 'tmux-plugins/tmux-sensible#"+test.ref+"'")
+			pluginPath := filepath.Join(dir, "plugins", "tmux-sensible")
+			fake := gittest.NewFake()
+			fake.AddRemote(sensibleURL, "main", "c0ffee1", "s2")
+			fake.Tag(sensibleURL, "v1.0.0", "c0ffee1")
+			fake.Tag(sensibleURL, "v1.1.0", "s2")
+
+			summary, err := run.Install(context.Background(), logger, run.Options{Git: fake})
+			require.NoError(t, err)
+			assert.Equal(t, []run.Result{{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded}}, results(summary))
+
+			fake.Push(sensibleURL, "main", "s3", "s4")
+			fake.Tag(sensibleURL, "v1.2.0", "s3")
+			fake.Tag(sensibleURL, "v2.0.0", "s4")
+
+			summary, err = run.Update(context.Background(), logger, run.Options{Git: fake}, []string{"tmux-sensible"})
+			require.NoError(t, err)
+			assert.Equal(t, []run.Action{
+				{Kind: run.ActionCheckout, Plugin: "tmux-sensible", URL: sensibleURL, Ref: test.ref, Path: pluginPath},
+			}, summary.Plan.Actions)
+			assert.Equal(t, []run.Result{test.expectedResult}, results(summary))
+			assert.Equal(t, test.expectedHead, fake.Head(pluginPath))
+
+			lockFile, err := lock.Read(filepath.Join(dir, lock.FileName))
+			require.NoError(t, err)
+			assert.Equal(t, lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Ref: test.ref, Commit: test.expectedHead},
+			}}, lockFile)
+		})
+	}
+}
+
+func TestUpdate_Selection(t *testing.T) {
+	tests := []struct {
+		name            string
+		plugins         []string
+		expectedResults []run.Result
+		expectedErr     string
+		expectedErrIs   error
+	}{
+		{
+			name:    "All",
+			plugins: nil,
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded, From: "s2", To: "s3"},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded, From: "y1", To: "y2"},
+				{Plugin: "tmux-resurrect", Outcome: run.OutcomeSkipped},
+			},
+		},
+		{
+			name:    "By Name",
+			plugins: []string{"tmux-yank"},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded, From: "y1", To: "y2"},
+			},
+		},
+		{
+			name:    "By Owner and Repo",
+			plugins: []string{"tmux-plugins/tmux-sensible", "tmux-yank"},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded, From: "s2", To: "s3"},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded, From: "y1", To: "y2"},
+			},
+		},
+		{
+			name:          "Not Configured",
+			plugins:       []string{"tmux-sensible", "tmux-copycat"},
+			expectedErr:   "plugin tmux-copycat: not configured in the tmux conf file",
+			expectedErrIs: run.ErrNotConfigured,
+		},
+		{
+			name:          "Not Installed",
+			plugins:       []string{"tmux-resurrect"},
+			expectedErr:   "plugin tmux-resurrect: not installed",
+			expectedErrIs: run.ErrNotInstalled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+`)
+			pluginsPath := filepath.Join(dir, "plugins")
+			fake := newFake()
+			require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+			require.NoError(t, fake.Clone(context.Background(), yankURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-yank"), nil))
+			fake.Push(sensibleURL, "main", "s3")
+			fake.Push(yankURL, "main", "y2")
+
+			summary, err := run.Update(context.Background(), logger, run.Options{Git: fake}, test.plugins)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, test.expectedErr, err.Error())
+				assert.ErrorIs(t, err, test.expectedErrIs)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedResults, results(summary))
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name            string
+		lock            *lock.File
+		installed       map[string]string
+		failReset       string
+		expectedResults []run.Result
+		expectedHeads   map[string]string
+		expectedErr     string
+	}{
+		{
+			name: "Clone Missing",
+			lock: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+				{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+			}},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s1", "tmux-yank": "y1"},
+		},
+		{
+			name: "Reset Drifted",
+			lock: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+				{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+			}},
+			installed: map[string]string{"tmux-sensible": "s2", "tmux-yank": "y1"},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded, From: "s2", To: "s1"},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSkipped},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s1", "tmux-yank": "y1"},
+		},
+		{
+			name: "Not In Lock",
+			lock: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+			}},
+			installed: map[string]string{"tmux-sensible": "s2"},
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded, From: "s2", To: "s1"},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSkipped},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s1", "tmux-yank": ""},
+		},
+		{
+			name: "Failure Does Not Stop Others",
+			lock: &lock.File{Plugins: []lock.Plugin{
+				{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1"},
+				{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+			}},
+			installed: map[string]string{"tmux-sensible": "s2"},
+			failReset: "tmux-sensible",
+			expectedResults: []run.Result{
+				{Plugin: "tmux-sensible", Outcome: run.OutcomeFailed, Err: errors.New("unknown revision")},
+				{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded},
+			},
+			expectedHeads: map[string]string{"tmux-sensible": "s2", "tmux-yank": "y1"},
+			expectedErr:   "plugin tmux-sensible: unknown revision",
+		},
+		{
+			name:        "Missing Lock File",
+			expectedErr: "does not exist (run install or update to create it)",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+`)
+			pluginsPath := filepath.Join(dir, "plugins")
+			fake := newFake()
+			for name, head := range test.installed {
+				path := filepath.Join(pluginsPath, name)
+				require.NoError(t, fake.Clone(context.Background(), "https://git::@github.com/tmux-plugins/"+name, git.Ref{}, path, nil))
+				fake.Commit(path, head)
+			}
+			if test.lock != nil {
+				require.NoError(t, lock.Write(filepath.Join(dir, lock.FileName), *test.lock))
+			}
+			if test.failReset != "" {
+				fake.FailOn("Reset", filepath.Join(pluginsPath, test.failReset), errors.New("unknown revision"))
+			}
+
+			summary, err := run.Restore(context.Background(), logger, run.Options{Git: fake})
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.expectedResults, results(summary))
+
+			for name, head := range test.expectedHeads {
+				assert.Equal(t, head, fake.Head(filepath.Join(pluginsPath, name)), name)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+`)
+	pluginsPath := filepath.Join(dir, "plugins")
+	sensiblePath := filepath.Join(pluginsPath, "tmux-sensible")
+	yankPath := filepath.Join(pluginsPath, "tmux-yank")
+	fake := newFake()
+	require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, sensiblePath, nil))
+	require.NoError(t, fake.Clone(context.Background(), yankURL, git.Ref{}, yankPath, nil))
+
+	_, err := run.Rollback(context.Background(), logger, run.Options{Git: fake}, nil, 1)
+	require.Error(t, err)
+	assert.Equal(t, "no update has changed a plugin yet, there is nothing to roll back", err.Error())
+
+	fake.Push(sensibleURL, "main", "s3")
+	fake.Push(yankURL, "main", "y2")
+	_, err = run.Update(context.Background(), logger, run.Options{Git: fake}, nil)
+	require.NoError(t, err)
+	fake.Push(sensibleURL, "main", "s4")
+	_, err = run.Update(context.Background(), logger, run.Options{Git: fake}, nil)
+	require.NoError(t, err)
+
+	summary, err := run.Rollback(context.Background(), logger, run.Options{DryRun: true, Git: fake}, nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []run.Action{
+		{Kind: run.ActionReset, Plugin: "tmux-sensible", URL: sensibleURL, Commit: "s3", Path: sensiblePath},
+	}, summary.Plan.Actions)
+	assert.Equal(t, "s4", fake.Head(sensiblePath))
+
+	summary, err = run.Rollback(context.Background(), logger, run.Options{Git: fake}, []string{"tmux-yank"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []run.Result{{Plugin: "tmux-yank", Outcome: run.OutcomeSkipped}}, results(summary))
+
+	summary, err = run.Rollback(context.Background(), logger, run.Options{Git: fake}, nil, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []run.Result{
+		{Plugin: "tmux-sensible", Outcome: run.OutcomeSucceeded, From: "s4", To: "s2"},
+		{Plugin: "tmux-yank", Outcome: run.OutcomeSucceeded, From: "y2", To: "y1"},
+	}, results(summary))
+	assert.Equal(t, "s2", fake.Head(sensiblePath))
+	assert.Equal(t, "y1", fake.Head(yankPath))
+
+	lockFile, err := lock.Read(filepath.Join(dir, lock.FileName))
+	require.NoError(t, err)
+	assert.Equal(t, lock.File{Plugins: []lock.Plugin{
+		{Name: "tmux-sensible", URL: sensibleURL, Commit: "s2"},
+		{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+	}}, lockFile)
+
+	_, err = run.Rollback(context.Background(), logger, run.Options{Git: fake}, nil, 3)
+	require.Error(t, err)
+	assert.Equal(t, "cannot roll back 3 updates, only 2 are recorded", err.Error())
+}
+
+func TestRollback_Sources(t *testing.T) {
+	dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+	pluginPath := filepath.Join(dir, "plugins", "tmux-sensible")
+	fake := newFake()
+	require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, pluginPath, nil))
+	require.NoError(t, os.WriteFile(filepath.Join(pluginPath, "sensible.tmux"), []byte("#!/bin/sh\ntouch sourced\n"), 0o755))
+
+	fake.Push(sensibleURL, "main", "s3")
+	_, err := run.Update(context.Background(), logger, run.Options{Git: fake}, nil)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(pluginPath, "sourced"))
+
+	t.Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+	_, err = run.Rollback(context.Background(), logger, run.Options{Git: fake}, nil, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "s2", fake.Head(pluginPath))
+	assert.FileExists(t, filepath.Join(pluginPath, "sourced"))
+}
+
+func TestRollback_SourceTimeout(t *testing.T) {
+	dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+	pluginPath := filepath.Join(dir, "plugins", "tmux-sensible")
+	fake := newFake()
+	require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, pluginPath, nil))
+	require.NoError(t, os.WriteFile(filepath.Join(pluginPath, "slow.tmux"), []byte("#!/bin/sh\nsleep 5\n"), 0o755))
+
+	fake.Push(sensibleURL, "main", "s3")
+	_, err := run.Update(context.Background(), logger, run.Options{Git: fake}, nil)
+	require.NoError(t, err)
+
+	t.Setenv("TMUX", "/tmp/tmux-1000/default,1,0")
+	_, err = run.Rollback(context.Background(), logger, run.Options{Git: fake, Timeout: 100 * time.Millisecond}, nil, 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "timed out after 100ms")
+	assert.Equal(t, "s2", fake.Head(pluginPath))
+}
+
+func TestOutdated(t *testing.T) {
+	dir := setupConfig(t, `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+set -g @plugin 'tmux-plugins/tmux-resurrect#v1.0.0'
+set -g @plugin 'tmux-plugins/tmux-continuum#~1.0'
+set -g @plugin 'tmux-plugins/tmux-copycat'
+`)
+	pluginsPath := filepath.Join(dir, "plugins")
+	fake := newFake()
+	fake.AddRemote(resurrectURL, "main", "r1", "r2")
+	fake.Tag(resurrectURL, "v1.0.0", "r1")
+	fake.Tag(resurrectURL, "v1.1.0", "r2")
+	fake.AddRemote(continuumURL, "main", "c1", "c2", "c3")
+	fake.Tag(continuumURL, "v1.0.0", "c1")
+	require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+	require.NoError(t, fake.Clone(context.Background(), yankURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-yank"), nil))
+	require.NoError(t, fake.Clone(context.Background(), resurrectURL, git.ParseRef("v1.0.0"), filepath.Join(pluginsPath, "tmux-resurrect"), nil))
+	require.NoError(t, fake.Clone(context.Background(), continuumURL, git.ParseRef("v1.0.0"), filepath.Join(pluginsPath, "tmux-continuum"), nil))
+
+	fake.Push(sensibleURL, "main", "s3", "s4")
+	fake.Tag(continuumURL, "v1.0.1", "c3")
+	fake.Tag(continuumURL, "v2.0.0", "c3")
+
+	report, err := run.Outdated(context.Background(), logger, run.Options{Git: fake}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []run.OutdatedPlugin{
+		{Name: "tmux-sensible", URL: sensibleURL, Commit: "s2", Outdated: true, Behind: 2, Latest: "s4", Subject: "subject of s4"},
+		{Name: "tmux-yank", URL: yankURL, Commit: "y1"},
+		{Name: "tmux-resurrect", URL: resurrectURL, Ref: "v1.0.0", Commit: "r1", Outdated: true, Latest: "v1.1.0"},
+		{Name: "tmux-continuum", URL: continuumURL, Ref: "~1.0", Commit: "c1", Outdated: true, Behind: 2, Latest: "v1.0.1", Subject: "subject of c3"},
+	}, report.Plugins)
+	assert.Equal(t, 3, report.Count())
+
+	fake.Push(yankURL, "main", "y2")
+
+	cached, err := run.Outdated(context.Background(), logger, run.Options{Git: fake}, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 3, cached.Count())
+
+	report, err = run.Outdated(context.Background(), logger, run.Options{Git: fake}, time.Nanosecond)
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.Count())
+}
+
+func TestOutdated_Cache(t *testing.T) {
+	cached := run.OutdatedReport{Plugins: []run.OutdatedPlugin{{Name: "tmux-sensible", URL: sensibleURL, Commit: "s1", Outdated: true, Latest: "s2"}}}
+	fetched := []run.OutdatedPlugin{{Name: "tmux-sensible", URL: sensibleURL, Commit: "s2"}}
+
+	tests := []struct {
+		name           string
+		cacheAge       time.Duration
+		otherPlugins   bool
+		maxAge         time.Duration
+		expectedCached bool
+	}{
+		{
+			name:           "Fresh",
+			cacheAge:       time.Minute,
+			maxAge:         time.Hour,
+			expectedCached: true,
+		},
+		{
+			name:     "Expired",
+			cacheAge: 2 * time.Hour,
+			maxAge:   time.Hour,
+		},
+		{
+			name:     "Not Cached",
+			cacheAge: time.Minute,
+		},
+		{
+			name:         "Other Plugins Dir",
+			cacheAge:     time.Minute,
+			otherPlugins: true,
+			maxAge:       time.Hour,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+			confPath := filepath.Join(dir, "tmux.conf")
+			pluginsPath := filepath.Join(dir, "plugins")
+			fake := newFake()
+			require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+
+			cachePluginsPath := pluginsPath
+			if test.otherPlugins {
+				cachePluginsPath = filepath.Join(dir, "other")
+			}
+			cachePath := filepath.Join(state.ConfigDir(confPath, cachePluginsPath), run.OutdatedFileName)
+			report := cached
+			report.Time = time.Now().UTC().Add(-test.cacheAge)
+			data, err := json.Marshal(report)
+			require.NoError(t, err)
+			require.NoError(t, os.MkdirAll(filepath.Dir(cachePath), os.ModePerm))
+			require.NoError(t, os.WriteFile(cachePath, data, 0o644))
+
+			calls := len(fake.Calls())
+			actual, err := run.Outdated(context.Background(), logger, run.Options{Git: fake}, test.maxAge)
+			require.NoError(t, err)
+			if test.expectedCached {
+				assert.Equal(t, cached.Plugins, actual.Plugins)
+				// nothing is fetched
+				assert.Len(t, fake.Calls(), calls)
+				return
+			}
+			assert.Equal(t, fetched, actual.Plugins)
+
+			// the fetched report is cached for the tmux conf file and plugins directory it is of
+			data, err = os.ReadFile(filepath.Join(state.ConfigDir(confPath, pluginsPath), run.OutdatedFileName))
+			require.NoError(t, err)
+			var written run.OutdatedReport
+			require.NoError(t, json.Unmarshal(data, &written))
+			assert.Equal(t, fetched, written.Plugins)
+			assert.WithinDuration(t, time.Now(), written.Time, time.Minute)
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		name             string
+		setup            func(t *testing.T, fake *gittest.Fake, pluginsPath string)
+		expected         run.PluginStatus
+		expectedOrphaned []string
+	}{
+		{
+			name:     "Missing",
+			expected: run.PluginStatus{State: run.StateMissing},
+		},
+		{
+			name: "Clean",
+			setup: func(t *testing.T, fake *gittest.Fake, pluginsPath string) {
+				require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+			},
+			expected: run.PluginStatus{State: run.StateClean, Commit: "s2", Upstream: "origin/main"},
+		},
+		{
+			name: "Dirty",
+			setup: func(t *testing.T, fake *gittest.Fake, pluginsPath string) {
+				path := filepath.Join(pluginsPath, "tmux-sensible")
+				require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, path, nil))
+				fake.SetDirty(path, true)
+			},
+			expected: run.PluginStatus{State: run.StateDirty, Commit: "s2", Upstream: "origin/main"},
+		},
+		{
+			name: "Behind",
+			setup: func(t *testing.T, fake *gittest.Fake, pluginsPath string) {
+				require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+				fake.Push(sensibleURL, "main", "s3", "s4")
+			},
+			expected: run.PluginStatus{State: run.StateClean, Commit: "s2", Upstream: "origin/main", Behind: 2},
+		},
+		{
+			name: "Ahead And Behind",
+			setup: func(t *testing.T, fake *gittest.Fake, pluginsPath string) {
+				path := filepath.Join(pluginsPath, "tmux-sensible")
+				require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, path, nil))
+				fake.Commit(path, "l1")
+				fake.Push(sensibleURL, "main", "s3")
+			},
+			expected: run.PluginStatus{State: run.StateClean, Commit: "l1", Upstream: "origin/main", Ahead: 1, Behind: 1},
+		},
+		{
+			name: "Not A Repository",
+			setup: func(t *testing.T, fake *gittest.Fake, pluginsPath string) {
+				require.NoError(t, os.MkdirAll(filepath.Join(pluginsPath, "tmux-sensible"), os.ModePerm))
+			},
+			expected: run.PluginStatus{State: run.StateUnknown},
+		},
+		{
+			name: "Orphaned",
+			setup: func(t *testing.T, fake *gittest.Fake, pluginsPath string) {
+				require.NoError(t, fake.Clone(context.Background(), sensibleURL, git.Ref{}, filepath.Join(pluginsPath, "tmux-sensible"), nil))
+				require.NoError(t, os.MkdirAll(filepath.Join(pluginsPath, "tmux-old"), os.ModePerm))
+			},
+			expected:         run.PluginStatus{State: run.StateClean, Commit: "s2", Upstream: "origin/main"},
+			expectedOrphaned: []string{"tmux-old"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+			pluginsPath := filepath.Join(dir, "plugins")
+			fake := newFake()
+			if test.setup != nil {
+				test.setup(t, fake, pluginsPath)
+			}
+
+			status, err := run.List(context.Background(), logger, run.Options{Git: fake})
+			require.NoError(t, err)
+
+			require.Len(t, status.Plugins, 1)
+			actual := status.Plugins[0]
+			if test.expected.State == run.StateUnknown {
+				assert.NotEmpty(t, actual.Error)
+			}
+			actual.Error = ""
+			expected := test.expected
+			expected.Name, expected.URL, expected.Path = "tmux-sensible", sensibleURL, filepath.Join(pluginsPath, "tmux-sensible")
+			assert.Equal(t, expected, actual)
+
+			var orphaned []string
+			for _, o := range status.Orphaned {
+				assert.Equal(t, run.StateOrphaned, o.State)
+				orphaned = append(orphaned, o.Name)
+			}
+			assert.Equal(t, test.expectedOrphaned, orphaned)
+		})
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name             string
+		conf             string
+		dryRun           bool
+		expectedActions  []string
+		expectedExisting []string
+		expectedRemoved  []string
+	}{
+		{
+			name:             "Remove Orphaned",
+			conf:             `set -g @plugin 'tmux-plugins/tmux-sensible'`,
+			expectedActions:  []string{"tmux-sensible-old"},
+			expectedExisting: []string{"tmux-sensible"},
+			expectedRemoved:  []string{"tmux-sensible-old"},
+		},
+		{
+			name:             "Dry Run",
+			conf:             `set -g @plugin 'tmux-plugins/tmux-sensible'`,
+			dryRun:           true,
+			expectedActions:  []string{"tmux-sensible-old"},
+			expectedExisting: []string{"tmux-sensible", "tmux-sensible-old"},
+		},
+		{
+			name:            "No Plugins",
+			conf:            ``,
+			expectedActions: []string{""},
+			expectedRemoved: []string{""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, test.conf)
+			pluginsPath := filepath.Join(dir, "plugins")
+			for _, name := range []string{"tmux-sensible", "tmux-sensible-old"} {
+				require.NoError(t, os.MkdirAll(filepath.Join(pluginsPath, name), os.ModePerm))
+			}
+
+			summary, err := run.Clean(context.Background(), logger, run.Options{DryRun: test.dryRun, Git: newFake()})
+			require.NoError(t, err)
+
+			var actions []string
+			for _, a := range summary.Plan.Actions {
+				assert.Equal(t, run.ActionRemove, a.Kind)
+				actions = append(actions, a.Plugin)
+			}
+			assert.Equal(t, test.expectedActions, actions)
+
+			for _, name := range test.expectedExisting {
+				assert.DirExists(t, filepath.Join(pluginsPath, name))
+			}
+			for _, name := range test.expectedRemoved {
+				assert.NoDirExists(t, filepath.Join(pluginsPath, name))
+			}
+		})
+	}
+}
@@ -8,29 +8,43 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/Piszmog/gtpm/tmux"
 )
 
-func Source(ctx context.Context, logger *slog.Logger) error {
-	if err := tmux.SetDefaultTPMPath(logger); err != nil {
+// Source binds the gtpm key bindings and runs the *.tmux file of every plugin in the tmux conf file.
+func Source(ctx context.Context, logger *slog.Logger, opts Options) error {
+	client := opts.tmux()
+
+	confPath, err := getConfigPath(ctx, logger, opts)
+	if err != nil {
 		return err
 	}
 
-	confPath, err := tmux.GetConfigFilePath(logger)
+	pluginsRootPath, err := getPluginsDir(ctx, logger, opts, confPath)
 	if err != nil {
 		return err
 	}
-	logger.Debug("found tmux conf file", "path", confPath)
+	if err = tmux.SetPluginManagerPath(ctx, logger, client, pluginsRootPath); err != nil {
+		return err
+	}
 
-	logger.Debug("binding keys")
-	if err = bindKeys(logger); err != nil {
+	// the key bindings run gtpm with the same conf file and plugin directory
+	command := "gtpm"
+	if opts.ConfigPath != "" {
+		command += " --config " + tmux.ShellQuote(confPath)
+	}
+	if opts.PluginsDir != "" {
+		command += " --plugins-dir " + tmux.ShellQuote(pluginsRootPath)
+	}
+	logger.Debug("binding keys", "command", command)
+	if err = bindKeys(ctx, logger, client, command); err != nil {
 		return err
 	}
 
 	logger.Debug("finding plugins from conf file", "path", confPath)
-	plugins, err := tmux.GetPlugins(confPath)
+	plugins, err := getPlugins(logger, confPath)
 	if err != nil {
 		return err
 	}
@@ -42,79 +56,119 @@ func Source(ctx context.Context, logger *slog.Logger) error {
 		logger.Debug("there are plugins to source", "plugins", plugins, "path", confPath)
 	}
 
-	rootPath := filepath.Dir(confPath)
-	pluginsRootPath := filepath.Join(rootPath, "plugins")
-
 	var pluginPaths []string
-	for _, p := range plugins {
-		plugin, err := tmux.ParsePlugin(p)
-		if err != nil {
-			return err
-		}
+	for _, plugin := range plugins {
 		pluginPaths = append(pluginPaths, filepath.Join(pluginsRootPath, plugin.Repo))
 	}
 
+	observer := opts.observer()
 	for _, p := range pluginPaths {
-		if info, err := os.Stat(p); err != nil {
+		if _, err := os.Stat(p); err != nil {
 			if os.IsNotExist(err) {
-				return errors.New("plugin " + info.Name() + " has not been installed")
+				name := filepath.Base(p)
+				observer.PluginFailed(name, ActionSource, ErrNotInstalled)
+				return &PluginError{Plugin: name, Err: ErrNotInstalled}
 			}
 		}
 	}
 
 	for _, p := range pluginPaths {
-		if strings.HasSuffix(p, "tpm") {
-			logger.Debug("skipping tpm plugin")
-			continue
-		}
-		files, err := os.ReadDir(p)
-		if err != nil {
-			return fmt.Errorf("failed to read directory: %w", err)
-		}
-		var executableName string
-		for _, file := range files {
-			if !file.IsDir() {
-				if filepath.Ext(file.Name()) == ".tmux" {
-					if executableName != "" {
-						return errors.New("there are multiple *.tmux files in " + p + " do not know which to source")
-					}
-					executableName = file.Name()
-				}
-			}
+		name := filepath.Base(p)
+		observer.PluginStarted(name, ActionSource)
+		start := time.Now()
+		if err = sourcePluginWithTimeout(ctx, logger, opts, p); err != nil {
+			observer.PluginFailed(name, ActionSource, err)
+			return err
 		}
+		observer.PluginDone(name, ActionSource, Result{Plugin: name, Outcome: OutcomeSucceeded, Duration: time.Since(start)})
+	}
+	logger.Debug("completed sourcing plugins")
 
-		if executableName == "" {
-			return errors.New("failed to find *.tmux file in " + p)
-		}
+	return nil
+}
 
-		cmd := exec.Command("./" + executableName)
-		cmd.Dir = p
+// sourcePluginWithTimeout runs the *.tmux file of the plugin at the path, stopping it when the
+// timeout of the options is reached.
+func sourcePluginWithTimeout(ctx context.Context, logger *slog.Logger, opts Options, p string) error {
+	pluginCtx, cancel := opts.withTimeout(ctx)
+	defer cancel()
+	err := sourcePlugin(pluginCtx, logger, p)
+	if err != nil && errors.Is(pluginCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return &PluginError{Plugin: filepath.Base(p), Err: fmt.Errorf("timed out after %s: %w", opts.Timeout, context.DeadlineExceeded)}
+	}
+	return err
+}
 
-		out, err := cmd.CombinedOutput()
-		logger.Debug("attempted to source plugin", "plugin", p, "output", out)
-		if err != nil {
-			return fmt.Errorf("failed to source plugin "+p+": %w", err)
-		}
+// sourcePlugin runs the *.tmux file of the plugin at the path.
+func sourcePlugin(ctx context.Context, logger *slog.Logger, p string) error {
+	if filepath.Base(p) == "tpm" {
+		logger.Debug("skipping tpm plugin")
+		return nil
 	}
-	logger.Debug("completed sourcing plugins")
+	executableName, err := findEntrypoint(p)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "./"+executableName)
+	cmd.Dir = p
+	// a script that leaves a background process holding its output is not waited on forever
+	cmd.WaitDelay = time.Second
 
+	out, err := cmd.CombinedOutput()
+	logger.Debug("attempted to source plugin", "plugin", p, "output", out)
+	if err != nil {
+		return &PluginError{Plugin: filepath.Base(p), Err: fmt.Errorf("failed to source: %w", err)}
+	}
 	return nil
 }
 
-func bindKeys(logger *slog.Logger) error {
-	installKey, err := tmux.GetOption("@tpm-intall")
+// findEntrypoint returns the name of the *.tmux file of the plugin at the path.
+func findEntrypoint(p string) (string, error) {
+	name := filepath.Base(p)
+	files, err := os.ReadDir(p)
+	if err != nil {
+		return "", &PluginError{Plugin: name, Err: fmt.Errorf("failed to read directory: %w", err)}
+	}
+	var executableName string
+	for _, file := range files {
+		if !file.IsDir() {
+			if filepath.Ext(file.Name()) == ".tmux" {
+				if executableName != "" {
+					return "", &PluginError{Plugin: name, Err: fmt.Errorf("%w in %s, do not know which to source", ErrMultipleEntrypoints, p)}
+				}
+				executableName = file.Name()
+			}
+		}
+	}
+
+	if executableName == "" {
+		return "", &PluginError{Plugin: name, Err: fmt.Errorf("%w in %s", ErrNoEntrypoint, p)}
+	}
+	return executableName, nil
+}
+
+// bindKeys binds the install, update and clean keys to run the gtpm command.
+func bindKeys(ctx context.Context, logger *slog.Logger, client tmux.Client, command string) error {
+	installKey, err := client.GetOption(ctx, "@tpm-install")
 	if err != nil {
 		return err
 	}
+	if installKey == "" {
+		// older versions read the install key from the misspelled option
+		if installKey, err = client.GetOption(ctx, "@tpm-intall"); err != nil {
+			return err
+		}
+	}
 	if installKey == "" {
 		installKey = "I"
 	}
 	logger.Debug("binding install key", "key", installKey)
-	if err = tmux.BindKey(installKey, "gtpm i"); err != nil {
+	if err = client.BindKey(ctx, installKey, command+" --progress i"); err != nil {
 		return err
 	}
 
-	updateKey, err := tmux.GetOption("@tpm-update")
+	updateKey, err := client.GetOption(ctx, "@tpm-update")
 	if err != nil {
 		return err
 	}
@@ -122,11 +176,11 @@ func bindKeys(logger *slog.Logger) error {
 		updateKey = "U"
 	}
 	logger.Debug("binding update key", "key", updateKey)
-	if err = tmux.BindKey(updateKey, "gtpm u"); err != nil {
+	if err = client.BindKey(ctx, updateKey, command+" --progress u"); err != nil {
 		return err
 	}
 
-	cleanKey, err := tmux.GetOption("@tpm-clean")
+	cleanKey, err := client.GetOption(ctx, "@tpm-clean")
 	if err != nil {
 		return err
 	}
@@ -134,7 +188,7 @@ func bindKeys(logger *slog.Logger) error {
 		cleanKey = "M-u"
 	}
 	logger.Debug("binding clean key", "key", cleanKey)
-	if err = tmux.BindKey(cleanKey, "gtpm c"); err != nil {
+	if err = client.BindKey(ctx, cleanKey, command+" c"); err != nil {
 		return err
 	}
 
@@ -0,0 +1,184 @@
+package run_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Piszmog/gtpm/run"
+	"github.com/Piszmog/gtpm/tmux/tmuxtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name             string
+		environment      func(dir string) map[string]string
+		options          map[string]string
+		expectedCommands func(dir string) [][]string
+	}{
+		{
+			name: "Defaults",
+			expectedCommands: func(dir string) [][]string {
+				return [][]string{
+					{"display-message", "-p", "#{config_files}"},
+					{"show-environment", "-g", "TMUX_PLUGIN_MANAGER_PATH"},
+					{"set-environment", "-g", "TMUX_PLUGIN_MANAGER_PATH", filepath.Join(dir, "plugins") + "/"},
+					{"show-option", "-gqv", "@tpm-install"},
+					{"show-option", "-gqv", "@tpm-intall"},
+					{"bind-key", "I", "run-shell", "gtpm --progress i"},
+					{"show-option", "-gqv", "@tpm-update"},
+					{"bind-key", "U", "run-shell", "gtpm --progress u"},
+					{"show-option", "-gqv", "@tpm-clean"},
+					{"bind-key", "M-u", "run-shell", "gtpm c"},
+				}
+			},
+		},
+		{
+			name: "Custom Keys",
+			options: map[string]string{
+				"@tpm-install": "i",
+				"@tpm-update":  "u",
+				"@tpm-clean":   "c",
+			},
+			expectedCommands: func(dir string) [][]string {
+				return [][]string{
+					{"display-message", "-p", "#{config_files}"},
+					{"show-environment", "-g", "TMUX_PLUGIN_MANAGER_PATH"},
+					{"set-environment", "-g", "TMUX_PLUGIN_MANAGER_PATH", filepath.Join(dir, "plugins") + "/"},
+					{"show-option", "-gqv", "@tpm-install"},
+					{"bind-key", "i", "run-shell", "gtpm --progress i"},
+					{"show-option", "-gqv", "@tpm-update"},
+					{"bind-key", "u", "run-shell", "gtpm --progress u"},
+					{"show-option", "-gqv", "@tpm-clean"},
+					{"bind-key", "c", "run-shell", "gtpm c"},
+				}
+			},
+		},
+		{
+			name:    "Old Install Key Option",
+			options: map[string]string{"@tpm-intall": "i"},
+			expectedCommands: func(dir string) [][]string {
+				return [][]string{
+					{"display-message", "-p", "#{config_files}"},
+					{"show-environment", "-g", "TMUX_PLUGIN_MANAGER_PATH"},
+					{"set-environment", "-g", "TMUX_PLUGIN_MANAGER_PATH", filepath.Join(dir, "plugins") + "/"},
+					{"show-option", "-gqv", "@tpm-install"},
+					{"show-option", "-gqv", "@tpm-intall"},
+					{"bind-key", "i", "run-shell", "gtpm --progress i"},
+					{"show-option", "-gqv", "@tpm-update"},
+					{"bind-key", "U", "run-shell", "gtpm --progress u"},
+					{"show-option", "-gqv", "@tpm-clean"},
+					{"bind-key", "M-u", "run-shell", "gtpm c"},
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+			pluginPath := filepath.Join(dir, "plugins", "tmux-sensible")
+			require.NoError(t, os.MkdirAll(pluginPath, os.ModePerm))
+			require.NoError(t, os.WriteFile(filepath.Join(pluginPath, "sensible.tmux"), []byte("#!/bin/sh\ntouch sourced\n"), 0o755))
+
+			fake := tmuxtest.NewFake()
+			if test.environment != nil {
+				for k, v := range test.environment(dir) {
+					fake.Environment[k] = v
+				}
+			}
+			for k, v := range test.options {
+				fake.Options[k] = v
+			}
+
+			observer := &recorder{}
+			err := run.Source(context.Background(), logger, run.Options{Tmux: fake, Observer: observer})
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedCommands(dir), fake.Commands())
+			assert.Equal(t, []string{"started tmux-sensible source", "done tmux-sensible source succeeded"}, observer.events)
+			assert.FileExists(t, filepath.Join(pluginPath, "sourced"))
+		})
+	}
+}
+
+func TestSource_ConfigPath(t *testing.T) {
+	setupConfig(t, "")
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "ci's.conf")
+	require.NoError(t, os.WriteFile(confPath, []byte(`set -g @plugin 'tmux-plugins/tmux-sensible'`), 0o644))
+	pluginsPath := filepath.Join(dir, "plugins")
+	pluginPath := filepath.Join(pluginsPath, "tmux-sensible")
+	require.NoError(t, os.MkdirAll(pluginPath, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(pluginPath, "sensible.tmux"), []byte("#!/bin/sh\ntouch sourced\n"), 0o755))
+
+	fake := tmuxtest.NewFake()
+	err := run.Source(context.Background(), logger, run.Options{Tmux: fake, ConfigPath: confPath, PluginsDir: pluginsPath})
+	require.NoError(t, err)
+	command := "gtpm --config '" + filepath.Join(dir, `ci'\''s.conf`) + "' --plugins-dir '" + pluginsPath + "'"
+	assert.Equal(t, [][]string{
+		{"set-environment", "-g", "TMUX_PLUGIN_MANAGER_PATH", pluginsPath + "/"},
+		{"show-option", "-gqv", "@tpm-install"},
+		{"show-option", "-gqv", "@tpm-intall"},
+		{"bind-key", "I", "run-shell", command + " --progress i"},
+		{"show-option", "-gqv", "@tpm-update"},
+		{"bind-key", "U", "run-shell", command + " --progress u"},
+		{"show-option", "-gqv", "@tpm-clean"},
+		{"bind-key", "M-u", "run-shell", command + " c"},
+	}, fake.Commands())
+	assert.FileExists(t, filepath.Join(pluginPath, "sourced"))
+}
+
+func TestSource_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		timeout     time.Duration
+		expectedErr error
+	}{
+		{
+			name:        "Not Installed",
+			expectedErr: run.ErrNotInstalled,
+		},
+		{
+			name:        "No Entrypoint",
+			files:       map[string]string{"README.md": ""},
+			expectedErr: run.ErrNoEntrypoint,
+		},
+		{
+			name:        "Multiple Entrypoints",
+			files:       map[string]string{"a.tmux": "", "b.tmux": ""},
+			expectedErr: run.ErrMultipleEntrypoints,
+		},
+		{
+			name:        "Timeout",
+			files:       map[string]string{"slow.tmux": "#!/bin/sh\nsleep 5\n"},
+			timeout:     100 * time.Millisecond,
+			expectedErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := setupConfig(t, `set -g @plugin 'tmux-plugins/tmux-sensible'`)
+			pluginPath := filepath.Join(dir, "plugins", "tmux-sensible")
+			if test.files != nil {
+				require.NoError(t, os.MkdirAll(pluginPath, os.ModePerm))
+			}
+			for name, content := range test.files {
+				require.NoError(t, os.WriteFile(filepath.Join(pluginPath, name), []byte(content), 0o755))
+			}
+
+			observer := &recorder{}
+			err := run.Source(context.Background(), logger, run.Options{Tmux: tmuxtest.NewFake(), Observer: observer, Timeout: test.timeout})
+			require.ErrorIs(t, err, test.expectedErr)
+			assert.Contains(t, observer.events, "failed tmux-sensible source")
+			var pluginErr *run.PluginError
+			require.ErrorAs(t, err, &pluginErr)
+			assert.Equal(t, "tmux-sensible", pluginErr.Plugin)
+		})
+	}
+}
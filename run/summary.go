@@ -0,0 +1,151 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Outcome is the outcome of an action performed on a plugin.
+type Outcome string
+
+const (
+	// OutcomeSucceeded is when the action on the plugin succeeded.
+	OutcomeSucceeded Outcome = "succeeded"
+	// OutcomeSkipped is when there was nothing to do for the plugin.
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeFailed is when the action on the plugin failed.
+	OutcomeFailed Outcome = "failed"
+)
+
+// Result is the result of an action performed on a plugin.
+type Result struct {
+	Plugin  string
+	Outcome Outcome
+	Err     error
+	// From and To are the commits the plugin moved between when it was updated.
+	From string
+	To   string
+	// Duration is how long the action took.
+	Duration time.Duration
+}
+
+// Detail describes the error of a failed plugin, or the commits a plugin moved between. An empty
+// string is returned when there is nothing to add to the outcome.
+func (r Result) Detail() string {
+	switch {
+	case r.Err != nil:
+		if pluginErr, ok := r.pluginErr(); ok {
+			return pluginErr.Err.Error()
+		}
+		return r.Err.Error()
+	case r.From != r.To:
+		return shortCommit(r.From) + " -> " + shortCommit(r.To)
+	default:
+		return ""
+	}
+}
+
+// pluginErr returns the error of the result when it already is a PluginError of the plugin, so
+// it is not wrapped a second time.
+func (r Result) pluginErr() (*PluginError, bool) {
+	pluginErr, ok := r.Err.(*PluginError)
+	return pluginErr, ok && pluginErr.Plugin == r.Plugin
+}
+
+// Summary is the aggregated results of the actions performed on the plugins.
+type Summary struct {
+	// Plan is the actions that were planned. When Options.DryRun is set, none of them were
+	// performed and there are no results.
+	Plan    Plan
+	Results []Result
+	// Changelog is the commits the plugins moved through. It is only set by Update.
+	Changelog Changelog
+}
+
+// Count returns the number of results with the outcome.
+func (s Summary) Count(outcome Outcome) int {
+	count := 0
+	for _, r := range s.Results {
+		if r.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+// Err returns the errors of all the failed plugins joined together. If no plugin failed, nil
+// is returned.
+func (s Summary) Err() error {
+	var errs []error
+	for _, r := range s.Results {
+		if r.Outcome != OutcomeFailed {
+			continue
+		}
+		if pluginErr, ok := r.pluginErr(); ok {
+			errs = append(errs, pluginErr)
+		} else {
+			errs = append(errs, &PluginError{Plugin: r.Plugin, Err: r.Err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the outcome of every plugin followed by the totals to w.
+func (s Summary) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range s.Results {
+		if detail := r.Detail(); detail != "" {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Plugin, r.Outcome, detail)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\n", r.Plugin, r.Outcome)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w, s.Totals())
+	return err
+}
+
+// Totals describes the number of plugins with each outcome.
+func (s Summary) Totals() string {
+	return fmt.Sprintf(
+		"%d succeeded, %d skipped, %d failed",
+		s.Count(OutcomeSucceeded),
+		s.Count(OutcomeSkipped),
+		s.Count(OutcomeFailed),
+	)
+}
+
+// shortCommit abbreviates the commit SHA to 7 characters.
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+// forEach calls fn for every item with at most jobs calls running at the same time. The
+// results are returned in the same order as the items.
+func forEach[T any, R any](jobs int, items []T, fn func(T) R) []R {
+	results := make([]R, len(items))
+	sem := make(chan struct{}, jobs)
+
+	var wg sync.WaitGroup
+	for i, p := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = fn(p)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
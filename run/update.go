@@ -2,99 +2,186 @@ package run
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"io/fs"
 	"log/slog"
-	"os"
 	"path/filepath"
-	"strings"
+	"slices"
 
 	"github.com/Piszmog/gtpm/git"
+	"github.com/Piszmog/gtpm/history"
 	"github.com/Piszmog/gtpm/tmux"
 )
 
-func Update(ctx context.Context, logger *slog.Logger, plugins []string) error {
+// Update fetches and fast-forwards the plugins with the names, or every configured plugin when
+// no names are given, and updates the lock file. Plugins pinned to a tag or commit are checked
+// out at it, and plugins pinned to a semver constraint move to the newest tag satisfying it.
+// The commits every plugin moved through are returned in the summary and recorded in the
+// history file.
+//
+// A failure to update one plugin does not stop the others from being updated. The outcome
+// of every plugin is returned in the summary, and the error contains all the plugins that failed.
+func Update(ctx context.Context, logger *slog.Logger, opts Options, plugins []string) (Summary, error) {
 	if len(plugins) == 0 {
 		logger.Debug("updating all plugins")
 	} else {
 		logger.Debug("updating plugins", "plugins", plugins)
 	}
 
+	client := opts.git(logger)
+
 	logger.Debug("checking if git is install")
-	if !git.IsInstalled(ctx) {
-		return errors.New("git is required to install plugins")
+	if !client.IsInstalled(ctx) {
+		return Summary{}, fmt.Errorf("%w to update plugins", ErrGitNotInstalled)
 	}
 
-	confPath, err := tmux.GetConfigFilePath(logger)
+	confPath, err := getConfigPath(ctx, logger, opts)
 	if err != nil {
-		return err
+		return Summary{}, err
 	}
-	logger.Debug("found tmux conf file", "path", confPath)
 
-	existingPlugins, err := tmux.GetPlugins(confPath)
+	configuredPlugins, err := getPlugins(logger, confPath)
 	if err != nil {
-		return err
+		return Summary{}, err
 	}
-	logger.Debug("configured plugins", "plugins", existingPlugins)
 
+	pluginsToUpdate := configuredPlugins
 	if len(plugins) > 0 {
-		for _, p := range plugins {
-			for _, configuredPlugin := range existingPlugins {
-				if !strings.Contains(configuredPlugin, p) {
-					return errors.New("cannot update plugin " + p + " is it not configured in your tmux conf file")
-				}
-			}
+		if pluginsToUpdate, err = selectPlugins(configuredPlugins, plugins); err != nil {
+			return Summary{}, err
 		}
 	}
 
-	rootPath := filepath.Dir(confPath)
-	pluginsPath := filepath.Join(rootPath, "plugins")
-	files, err := os.ReadDir(pluginsPath)
+	pluginsPath, err := getPluginsDir(ctx, logger, opts, confPath)
 	if err != nil {
-		return fmt.Errorf("failed to read plugin directory: %w", err)
-	}
-
-	var pluginPathsToUpdate []string
-	for _, p := range plugins {
-		for _, configuredPlugin := range existingPlugins {
-			if strings.Contains(configuredPlugin, p) {
-				plugin, err := tmux.ParsePlugin(configuredPlugin)
-				if err != nil {
-					return err
-				}
-				pluginPathsToUpdate = append(pluginPathsToUpdate, filepath.Join(pluginsPath, plugin.Repo))
+		return Summary{}, err
+	}
+	files, err := readPluginsDir(pluginsPath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	var plan Plan
+	for _, plugin := range pluginsToUpdate {
+		path := filepath.Join(pluginsPath, plugin.Repo)
+		if !isInstalled(plugin, files) {
+			if len(plugins) > 0 {
+				return Summary{}, &PluginError{Plugin: plugin.Repo, Err: ErrNotInstalled}
 			}
+			logger.Debug("plugin is not installed", "plugin", plugin.Repo)
+			plan.Actions = append(plan.Actions, Action{Kind: ActionSkip, Plugin: plugin.Repo, Path: path, Reason: "not installed"})
+			continue
+		}
+		kind := ActionPull
+		if plugin.Ref.IsPinned() {
+			kind = ActionCheckout
 		}
+		plan.Actions = append(plan.Actions, Action{
+			Kind:   kind,
+			Plugin: plugin.Repo,
+			URL:    plugin.URL,
+			Ref:    plugin.Ref.String(),
+			Path:   path,
+		})
 	}
 
-	logger.Debug("checking if any plugins are not installed")
-	err = checkInstalledPlugins(plugins, files)
+	if opts.DryRun {
+		logger.Debug("dry run, not updating plugins")
+		return Summary{Plan: plan}, nil
+	}
+
+	summary := plan.execute(ctx, logger, client, opts)
+
+	if err = updateLock(ctx, logger, client, confPath, pluginsPath, configuredPlugins, summary); err != nil {
+		return summary, err
+	}
+
+	summary.Changelog = changelog(ctx, logger, client, summary)
+	if err = summary.Changelog.record(logger, history.Path(confPath, pluginsPath)); err != nil {
+		return summary, err
+	}
+
+	return summary, summary.Err()
+}
+
+// updatePlugin fast-forwards the plugin at the path to the latest changes of its branch and
+// returns the commit of the plugin before and after.
+func updatePlugin(ctx context.Context, logger *slog.Logger, client git.Client, path string) (string, string, error) {
+	before, err := client.RevParse(ctx, path, "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	if err = git.Update(ctx, logger, client, path); err != nil {
+		return "", "", err
+	}
+	after, err := client.RevParse(ctx, path, "HEAD")
 	if err != nil {
-		return err
+		return "", "", err
 	}
+	return before, after, nil
+}
 
-	for _, p := range pluginPathsToUpdate {
-		if err = git.Update(logger, p); err != nil {
-			return err
+// checkoutPlugin checks out the ref of the plugin at the path and returns the commit of the
+// plugin before and after. The ref is fetched first, since it may not exist locally yet.
+func checkoutPlugin(ctx context.Context, logger *slog.Logger, client git.Client, url string, ref git.Ref, path string) (string, string, error) {
+	ref, err := resolveRef(ctx, logger, client, url, ref)
+	if err != nil {
+		return "", "", err
+	}
+
+	before, err := client.RevParse(ctx, path, "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+
+	switch ref.Type {
+	case git.RefTag:
+		// force the tag to be updated in case it was moved on the remote
+		err = client.Fetch(ctx, path, "+refs/tags/"+ref.Name+":refs/tags/"+ref.Name)
+	case git.RefCommit:
+		if _, err = client.RevParse(ctx, path, ref.Name); err != nil {
+			logger.Debug("commit is not available locally, fetching it", "path", path, "commit", ref.Name)
+			err = client.Fetch(ctx, path, ref.Name)
 		}
 	}
+	if err != nil {
+		return "", "", err
+	}
 
-	return nil
+	after, err := client.RevParse(ctx, path, ref.Name)
+	if err != nil {
+		return "", "", err
+	}
+	if before == after {
+		return before, after, nil
+	}
+
+	logger.Debug("checking out plugin", "path", path, "ref", ref.String(), "commit", after)
+	if err = client.Checkout(ctx, path, ref.Name); err != nil {
+		return "", "", err
+	}
+	if err = client.SubmoduleUpdate(ctx, path); err != nil {
+		return "", "", err
+	}
+	return before, after, nil
 }
 
-func checkInstalledPlugins(plugins []string, files []fs.DirEntry) error {
-	for _, p := range plugins {
-		pluginInstalled := false
-		for _, file := range files {
-			if file.IsDir() && strings.Contains(p, file.Name()) {
-				pluginInstalled = true
-				break
-			}
+// selectPlugins returns the configured plugins with the names. A plugin can be selected by the
+// name of its directory, <owner>/<repo> or its URL.
+func selectPlugins(configured []tmux.Plugin, names []string) ([]tmux.Plugin, error) {
+	var selected []tmux.Plugin
+	for _, name := range names {
+		i := slices.IndexFunc(configured, func(p tmux.Plugin) bool { return matchesPlugin(p, name) })
+		if i < 0 {
+			return nil, &PluginError{Plugin: name, Err: ErrNotConfigured}
 		}
-		if !pluginInstalled {
-			return errors.New("plugin " + p + " is not installed")
+		if !slices.Contains(selected, configured[i]) {
+			selected = append(selected, configured[i])
 		}
 	}
-	return nil
+	return selected, nil
+}
+
+// matchesPlugin determines if the name is the name, <owner>/<repo> or URL of the plugin.
+func matchesPlugin(p tmux.Plugin, name string) bool {
+	return name == p.Repo || name == p.Owner+"/"+p.Repo || name == p.URL
 }
@@ -0,0 +1,324 @@
+// Package semver parses semantic versions and constraints to resolve the tag a plugin is pinned to.
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version (e.g. v1.2.3-rc.1).
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// Parse parses a version. The version may be prefixed with v, and the minor and patch
+// versions may be omitted (e.g. v1.2 is v1.2.0). Build metadata is ignored.
+func Parse(s string) (Version, error) {
+	v, parts, err := parse(s)
+	if err != nil {
+		return Version{}, err
+	}
+	for _, p := range parts {
+		if p < 0 {
+			return Version{}, errors.New("invalid version " + s + ": wildcards are not allowed")
+		}
+	}
+	return v, nil
+}
+
+// parse parses a version that may contain wildcards (x, X or *). The returned parts are the
+// major, minor and patch versions as written, with -1 for wildcards and omitted parts.
+func parse(s string) (Version, []int, error) {
+	original := s
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	s, _, _ = strings.Cut(s, "+")
+	s, prerelease, _ := strings.Cut(s, "-")
+	if s == "" {
+		return Version{}, nil, errors.New("invalid version " + original)
+	}
+
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return Version{}, nil, errors.New("invalid version " + original)
+	}
+
+	parts := []int{-1, -1, -1}
+	for i, f := range fields {
+		if f == "x" || f == "X" || f == "*" {
+			continue
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return Version{}, nil, errors.New("invalid version " + original)
+		}
+		if i > 0 && parts[i-1] < 0 {
+			return Version{}, nil, errors.New("invalid version " + original + ": a number cannot follow a wildcard")
+		}
+		parts[i] = n
+	}
+	parts = parts[:len(fields)]
+
+	v := Version{Prerelease: prerelease}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		if p > 0 {
+			*nums[i] = p
+		}
+	}
+	return v, parts, nil
+}
+
+// String returns the version without a v prefix.
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1 if v is less than o, 1 if v is greater than o, and 0 if they are equal.
+func (v Version) Compare(o Version) int {
+	for _, c := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if c[0] < c[1] {
+			return -1
+		}
+		if c[0] > c[1] {
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+func comparePrerelease(a string, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	aIDs, bIDs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aNum, aErr := strconv.Atoi(aIDs[i])
+		bNum, bErr := strconv.Atoi(bIDs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				return compareInts(aNum, bNum)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aIDs[i], bIDs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(aIDs), len(bIDs))
+}
+
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Constraint is a range of versions, such as ^1.2, ~1.2.3, >=1.0 <2.0, 1.x or 1.2 || 2.x.
+type Constraint struct {
+	original string
+	// groups are or'ed together, and the comparators in a group are and'ed together.
+	groups [][]comparator
+}
+
+type comparator struct {
+	op      string
+	version Version
+}
+
+// ParseConstraint parses a constraint.
+//
+// The supported operators are =, !=, >, >=, <, <=, ~ (patch updates) and ^ (updates that do
+// not change the left-most non-zero number). Versions can contain wildcards (x, X, *).
+// Comparators separated by spaces or commas must all match, and groups separated by || are
+// alternatives.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{original: s}
+	for _, group := range strings.Split(s, "||") {
+		var comparators []comparator
+		for _, field := range strings.FieldsFunc(group, func(r rune) bool { return r == ' ' || r == ',' }) {
+			parsed, err := parseComparator(field)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("invalid constraint %s: %w", s, err)
+			}
+			comparators = append(comparators, parsed...)
+		}
+		if len(comparators) == 0 {
+			return Constraint{}, errors.New("invalid constraint " + s + ": empty range")
+		}
+		c.groups = append(c.groups, comparators)
+	}
+	return c, nil
+}
+
+// String returns the constraint as it was parsed.
+func (c Constraint) String() string {
+	return c.original
+}
+
+func parseComparator(s string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			break
+		}
+	}
+	v, parts, err := parse(strings.TrimSpace(s[len(op):]))
+	if err != nil {
+		return nil, err
+	}
+
+	// the index of the first wildcard or omitted part
+	wildcard := len(parts)
+	for i, p := range parts {
+		if p < 0 {
+			wildcard = i
+			break
+		}
+	}
+
+	switch op {
+	case "^":
+		upper := Version{}
+		switch {
+		case v.Major > 0 || wildcard <= 1:
+			upper.Major = v.Major + 1
+		case v.Minor > 0 || wildcard <= 2:
+			upper.Minor = v.Minor + 1
+		default:
+			upper.Patch = v.Patch + 1
+		}
+		return []comparator{{">=", v}, {"<", lowestPrerelease(upper)}}, nil
+	case "~":
+		upper := Version{Major: v.Major, Minor: v.Minor + 1}
+		if wildcard <= 1 {
+			upper = Version{Major: v.Major + 1}
+		}
+		return []comparator{{">=", v}, {"<", lowestPrerelease(upper)}}, nil
+	case "", "=":
+		switch wildcard {
+		case 0:
+			return []comparator{{">=", Version{}}}, nil
+		case 1:
+			return []comparator{{">=", v}, {"<", lowestPrerelease(Version{Major: v.Major + 1})}}, nil
+		case 2:
+			return []comparator{{">=", v}, {"<", lowestPrerelease(Version{Major: v.Major, Minor: v.Minor + 1})}}, nil
+		}
+		return []comparator{{"=", v}}, nil
+	default:
+		if wildcard < 3 && (op == ">" || op == "<=") {
+			// >1.2 means greater than any 1.2.x version
+			switch wildcard {
+			case 0:
+				if op == ">" {
+					return []comparator{{"<", Version{}}}, nil
+				}
+				return []comparator{{">=", Version{}}}, nil
+			case 1:
+				v = Version{Major: v.Major + 1}
+			case 2:
+				v = Version{Major: v.Major, Minor: v.Minor + 1}
+			}
+			if op == ">" {
+				return []comparator{{">=", v}}, nil
+			}
+			return []comparator{{"<", lowestPrerelease(v)}}, nil
+		}
+		return []comparator{{op, v}}, nil
+	}
+}
+
+// lowestPrerelease returns the lowest prerelease of the version, so that an upper bound of
+// <2.0.0 also excludes 2.0.0-rc.1.
+func lowestPrerelease(v Version) Version {
+	v.Prerelease = "0"
+	return v
+}
+
+// Check determines if the version satisfies the constraint. Prereleases only satisfy the
+// constraint if a comparator of the same major, minor and patch version is a prerelease.
+func (c Constraint) Check(v Version) bool {
+	for _, group := range c.groups {
+		if checkGroup(group, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkGroup(group []comparator, v Version) bool {
+	allowPrerelease := v.Prerelease == ""
+	for _, comp := range group {
+		if !comp.check(v) {
+			return false
+		}
+		cv := comp.version
+		if cv.Prerelease != "" && cv.Prerelease != "0" &&
+			cv.Major == v.Major && cv.Minor == v.Minor && cv.Patch == v.Patch {
+			allowPrerelease = true
+		}
+	}
+	return allowPrerelease
+}
+
+func (c comparator) check(v Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return false
+	}
+}
+
+// Latest returns the highest of the tags that is a version satisfying the constraint. Tags
+// that are not versions are ignored. If no tag satisfies the constraint, false is returned.
+func (c Constraint) Latest(tags []string) (string, bool) {
+	var latestTag string
+	var latest Version
+	for _, tag := range tags {
+		v, err := Parse(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if latestTag == "" || v.Compare(latest) > 0 {
+			latestTag, latest = tag, v
+		}
+	}
+	return latestTag, latestTag != ""
+}
@@ -0,0 +1,216 @@
+package semver_test
+
+import (
+	"testing"
+
+	"github.com/Piszmog/gtpm/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name            string
+		version         string
+		expectedVersion semver.Version
+		expectedErr     string
+	}{
+		{
+			name:            "Full",
+			version:         "1.2.3",
+			expectedVersion: semver.Version{Major: 1, Minor: 2, Patch: 3},
+		},
+		{
+			name:            "Prefix",
+			version:         "v1.2.3",
+			expectedVersion: semver.Version{Major: 1, Minor: 2, Patch: 3},
+		},
+		{
+			name:            "Omitted Parts",
+			version:         "v1.2",
+			expectedVersion: semver.Version{Major: 1, Minor: 2},
+		},
+		{
+			name:            "Prerelease and Build",
+			version:         "1.2.3-rc.1+build.5",
+			expectedVersion: semver.Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1"},
+		},
+		{
+			name:        "Wildcard",
+			version:     "1.x",
+			expectedErr: "invalid version 1.x: wildcards are not allowed",
+		},
+		{
+			name:        "Not a Version",
+			version:     "latest",
+			expectedErr: "invalid version latest",
+		},
+		{
+			name:        "Too Many Parts",
+			version:     "1.2.3.4",
+			expectedErr: "invalid version 1.2.3.4",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := semver.Parse(test.version)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, test.expectedErr, err.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedVersion, v)
+			}
+		})
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{a: "1.2.3", b: "1.2.3", expected: 0},
+		{a: "1.2.3", b: "1.2.4", expected: -1},
+		{a: "1.10.0", b: "1.9.0", expected: 1},
+		{a: "2.0.0", b: "1.99.99", expected: 1},
+		{a: "1.0.0-rc.1", b: "1.0.0", expected: -1},
+		{a: "1.0.0-rc.2", b: "1.0.0-rc.10", expected: -1},
+		{a: "1.0.0-alpha", b: "1.0.0-1", expected: 1},
+		{a: "1.0.0-alpha", b: "1.0.0-alpha.1", expected: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" "+test.b, func(t *testing.T) {
+			a, err := semver.Parse(test.a)
+			require.NoError(t, err)
+			b, err := semver.Parse(test.b)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, a.Compare(b))
+		})
+	}
+}
+
+func TestConstraint_Check(t *testing.T) {
+	tests := []struct {
+		constraint  string
+		matching    []string
+		notMatching []string
+	}{
+		{
+			constraint:  "^1.2",
+			matching:    []string{"1.2.0", "1.2.9", "1.9.0"},
+			notMatching: []string{"1.1.9", "2.0.0", "2.0.0-rc.1", "1.3.0-rc.1"},
+		},
+		{
+			constraint:  "^0.2.3",
+			matching:    []string{"0.2.3", "0.2.9"},
+			notMatching: []string{"0.2.2", "0.3.0"},
+		},
+		{
+			constraint:  "^0.0.3",
+			matching:    []string{"0.0.3"},
+			notMatching: []string{"0.0.4"},
+		},
+		{
+			constraint:  "~1.2.3",
+			matching:    []string{"1.2.3", "1.2.9"},
+			notMatching: []string{"1.2.2", "1.3.0"},
+		},
+		{
+			constraint:  "~1",
+			matching:    []string{"1.0.0", "1.9.9"},
+			notMatching: []string{"2.0.0"},
+		},
+		{
+			constraint:  "1.x",
+			matching:    []string{"1.0.0", "1.9.9"},
+			notMatching: []string{"0.9.9", "2.0.0"},
+		},
+		{
+			constraint:  "1.2",
+			matching:    []string{"1.2.0", "1.2.5"},
+			notMatching: []string{"1.3.0"},
+		},
+		{
+			constraint:  "*",
+			matching:    []string{"0.0.1", "9.9.9"},
+			notMatching: []string{"1.0.0-rc.1"},
+		},
+		{
+			constraint:  "=1.2.3",
+			matching:    []string{"1.2.3"},
+			notMatching: []string{"1.2.4"},
+		},
+		{
+			constraint:  ">=1.0 <2.0",
+			matching:    []string{"1.0.0", "1.5.0"},
+			notMatching: []string{"0.9.0", "2.0.0"},
+		},
+		{
+			constraint:  ">1.2",
+			matching:    []string{"1.3.0"},
+			notMatching: []string{"1.2.9"},
+		},
+		{
+			constraint:  "<=1.2",
+			matching:    []string{"1.2.9"},
+			notMatching: []string{"1.3.0"},
+		},
+		{
+			constraint:  ">=1.0.0, !=1.1.0",
+			matching:    []string{"1.0.0", "1.2.0"},
+			notMatching: []string{"1.1.0"},
+		},
+		{
+			constraint:  "^1.0 || ^3.0",
+			matching:    []string{"1.5.0", "3.1.0"},
+			notMatching: []string{"2.0.0"},
+		},
+		{
+			constraint:  ">=2.0.0-rc.1",
+			matching:    []string{"2.0.0-rc.2", "2.0.0", "2.1.0"},
+			notMatching: []string{"2.0.0-beta", "2.1.0-rc.1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.constraint, func(t *testing.T) {
+			c, err := semver.ParseConstraint(test.constraint)
+			require.NoError(t, err)
+			for _, s := range test.matching {
+				v, err := semver.Parse(s)
+				require.NoError(t, err)
+				assert.True(t, c.Check(v), s)
+			}
+			for _, s := range test.notMatching {
+				v, err := semver.Parse(s)
+				require.NoError(t, err)
+				assert.False(t, c.Check(v), s)
+			}
+		})
+	}
+}
+
+func TestParseConstraint_Invalid(t *testing.T) {
+	for _, constraint := range []string{"", "^", "^foo", "1.x.2", "1.2 ||"} {
+		t.Run(constraint, func(t *testing.T) {
+			_, err := semver.ParseConstraint(constraint)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestConstraint_Latest(t *testing.T) {
+	c, err := semver.ParseConstraint("^1.2")
+	require.NoError(t, err)
+
+	tag, ok := c.Latest([]string{"v1.1.0", "v1.2.0", "v1.10.0", "v1.9.0", "v2.0.0", "latest", "v1.11.0-rc.1"})
+	assert.True(t, ok)
+	assert.Equal(t, "v1.10.0", tag)
+
+	_, ok = c.Latest([]string{"v2.0.0"})
+	assert.False(t, ok)
+}
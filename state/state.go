@@ -0,0 +1,33 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// Dir returns the directory gtpm keeps its state in. It is $XDG_STATE_HOME/gtpm, falling back to
+// $HOME/.local/state/gtpm when $XDG_STATE_HOME is not set.
+func Dir() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		stateHome = filepath.Join(os.Getenv("HOME"), ".local", "state")
+	}
+	return filepath.Join(stateHome, "gtpm")
+}
+
+// ConfigDir returns the directory in Dir that keeps the state of the plugins the tmux conf file
+// installs to the plugins directory. Each pair of tmux conf file and plugins directory gets its
+// own directory, so running with another --config or --plugins-dir does not act on this state.
+func ConfigDir(confPath string, pluginsPath string) string {
+	hash := sha256.Sum256([]byte(absPath(confPath) + "\x00" + absPath(pluginsPath)))
+	return filepath.Join(Dir(), "configs", hex.EncodeToString(hash[:8]))
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,27 @@
+package state_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Piszmog/gtpm/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDir(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("XDG_STATE_HOME", "")
+	assert.Equal(t, filepath.Join("/home", "me", ".local", "state", "gtpm"), state.Dir())
+	t.Setenv("XDG_STATE_HOME", "/home/me/state")
+	assert.Equal(t, filepath.Join("/home", "me", "state", "gtpm"), state.Dir())
+}
+
+func TestConfigDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/home/me/state")
+	dir := state.ConfigDir("/home/me/.tmux.conf", "/home/me/.tmux/plugins")
+
+	assert.Equal(t, filepath.Join("/home", "me", "state", "gtpm", "configs"), filepath.Dir(dir))
+	assert.Equal(t, dir, state.ConfigDir("/home/me/.tmux.conf", "/home/me/.tmux/plugins/"))
+	assert.NotEqual(t, dir, state.ConfigDir("/home/me/ci.conf", "/home/me/.tmux/plugins"))
+	assert.NotEqual(t, dir, state.ConfigDir("/home/me/.tmux.conf", "/tmp/plugins"))
+}
@@ -0,0 +1,126 @@
+package tmux
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Client runs commands against the running tmux server.
+type Client interface {
+	// Version returns the version of tmux (e.g. 3.4). It does not need a running server.
+	Version(ctx context.Context) (string, error)
+	// ShowEnvironment returns the value of the global environment variable. If the variable is
+	// not set, false is returned.
+	ShowEnvironment(ctx context.Context, name string) (string, bool, error)
+	// SetEnvironment sets the global environment variable.
+	SetEnvironment(ctx context.Context, name string, value string) error
+	// GetOption returns the value of the global option. If the option is not set, an empty
+	// string is returned.
+	GetOption(ctx context.Context, option string) (string, error)
+	// BindKey binds the key to run the shell command.
+	BindKey(ctx context.Context, key string, command string) error
+	// DisplayMessage returns the format (e.g. #{version}) expanded by the server.
+	DisplayMessage(ctx context.Context, format string) (string, error)
+	// DisplayPopup runs the shell command in a popup with the title, closing it when the command
+	// exits. It fails on versions of tmux without popups (before 3.2).
+	DisplayPopup(ctx context.Context, title string, command string) error
+}
+
+// ExecClient is a Client that runs the tmux executable.
+type ExecClient struct{}
+
+var _ Client = (*ExecClient)(nil)
+
+// NewExecClient creates a Client that runs the tmux executable on the PATH.
+func NewExecClient() *ExecClient {
+	return &ExecClient{}
+}
+
+func (c *ExecClient) Version(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "tmux", "-V")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get version of tmux: %w", err)
+	}
+	return strings.TrimPrefix(strings.TrimSpace(string(out)), "tmux "), nil
+}
+
+func (c *ExecClient) ShowEnvironment(ctx context.Context, name string) (string, bool, error) {
+	cmd := exec.CommandContext(ctx, "tmux", "show-environment", "-g", name)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			switch exitError.ExitCode() {
+			case 1:
+				return "", false, nil
+			default:
+				return "", false, fmt.Errorf("failed determine if "+name+" is set: %s", exitError.Error())
+			}
+		}
+		return "", false, fmt.Errorf("failed determine if "+name+" is set: %w", err)
+	}
+
+	_, value, found := strings.Cut(strings.TrimSpace(string(out)), "=")
+	if !found {
+		// a variable that is removed from the environment is shown as -NAME
+		return "", false, nil
+	}
+	return value, true, nil
+}
+
+func (c *ExecClient) SetEnvironment(ctx context.Context, name string, value string) error {
+	cmd := exec.CommandContext(ctx, "tmux", "set-environment", "-g", name, value)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set "+name+": %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (c *ExecClient) GetOption(ctx context.Context, option string) (string, error) {
+	cmd := exec.CommandContext(ctx, "tmux", "show-option", "-gqv", option)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			switch exitError.ExitCode() {
+			case 1:
+				return "", nil
+			default:
+				return "", fmt.Errorf("failed to find option for "+option+": %w", err)
+			}
+		}
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c *ExecClient) BindKey(ctx context.Context, key string, command string) error {
+	cmd := exec.CommandContext(ctx, "tmux", "bind-key", key, "run-shell", command)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to bind key "+key+" to "+command+": %w", err)
+	}
+	return nil
+}
+
+func (c *ExecClient) DisplayMessage(ctx context.Context, format string) (string, error) {
+	cmd := exec.CommandContext(ctx, "tmux", "display-message", "-p", format)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to display "+format+": %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c *ExecClient) DisplayPopup(ctx context.Context, title string, command string) error {
+	cmd := exec.CommandContext(ctx, "tmux", "display-popup", "-E", "-T", title, command)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to display popup: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ShellQuote quotes the string so the shell passes it as a single argument, e.g. in the command
+// of BindKey or DisplayPopup.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,351 @@
+package tmux
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GetPlugins returns the plugins declared in the tmux conf file at the path, including the
+// plugins declared in the files it sources.
+func GetPlugins(path string) ([]string, error) {
+	declarations, err := FindPlugins(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var plugins []string
+	for _, d := range declarations {
+		plugins = append(plugins, d.Plugin)
+	}
+	return plugins, nil
+}
+
+// PluginManager returns the name of the plugin manager (gtpm or tpm) the run-shell command sources
+// plugins with (e.g. run 'gtpm source' or run '~/.tmux/plugins/tpm/tpm'). It is empty for any
+// other command.
+func (c Command) PluginManager() string {
+	if c.Name != "run" && c.Name != "run-shell" {
+		return ""
+	}
+	var args []string
+	for i := 0; i < len(c.Args); i++ {
+		switch arg := c.Args[i]; {
+		case arg == "-d" || arg == "-t":
+			i++
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+		default:
+			args = append(args, arg)
+		}
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	fields := strings.Fields(args[0])
+	for i, field := range fields {
+		switch filepath.Base(field) {
+		case "gtpm":
+			if i+1 < len(fields) && (fields[i+1] == "source" || fields[i+1] == "s") {
+				return "gtpm"
+			}
+		case "tpm":
+			return "tpm"
+		}
+	}
+	return ""
+}
+
+// FindPluginManager returns the last command in the statement that sources plugins with the
+// plugin manager (gtpm or tpm, see Command.PluginManager), including the commands in every block
+// of conditionals.
+func FindPluginManager(node Node, manager string) (Command, bool) {
+	switch n := node.(type) {
+	case Command:
+		if n.PluginManager() == manager {
+			return n, true
+		}
+	case Conditional:
+		var found Command
+		ok := false
+		for _, branch := range n.Branches {
+			if cmd, branchOK := findPluginManager(branch.Nodes, manager); branchOK {
+				found, ok = cmd, true
+			}
+		}
+		if cmd, elseOK := findPluginManager(n.Else, manager); elseOK {
+			found, ok = cmd, true
+		}
+		return found, ok
+	}
+	return Command{}, false
+}
+
+func findPluginManager(nodes []Node, manager string) (Command, bool) {
+	var found Command
+	ok := false
+	for _, node := range nodes {
+		if cmd, nodeOK := FindPluginManager(node, manager); nodeOK {
+			found, ok = cmd, true
+		}
+	}
+	return found, ok
+}
+
+// Declaration is a plugin declared in a tmux conf file.
+type Declaration struct {
+	// Plugin is the plugin as it is declared (e.g. owner/repo#branch).
+	Plugin string
+	// File is the path of the file the plugin is declared in.
+	File string
+	// Line is the line number of the declaration in the file.
+	Line int
+}
+
+// FindPlugins returns the plugins declared in the tmux conf file at the path.
+//
+// Plugins are declared with set-option @plugin (or the legacy @tpm_plugins). Blocks in %if
+// conditionals are included unless the condition is a constant that is false.
+//
+// Files sourced with source-file (or source) are followed recursively. The paths of sourced files
+// can contain ~, environment variables and glob patterns. Relative paths are resolved from the
+// directory of the file sourcing them. Each file is only read once, so sourcing cycles are ignored.
+func FindPlugins(path string) ([]Declaration, error) {
+	f := newPluginFinder()
+	if err := f.find(path); err != nil {
+		return nil, err
+	}
+	return f.declarations, nil
+}
+
+// Settings are the user options and global environment variables set in a tmux conf file.
+type Settings struct {
+	// Options are the values of the user options (e.g. @gtpm-plugin-dir) by name.
+	Options map[string]string
+	// Environment is the global environment set with set-environment -g.
+	Environment map[string]string
+}
+
+// FindSettings returns the user options and global environment variables set in the tmux conf
+// file at the path. Files are followed the same way as FindPlugins, and later values replace
+// earlier ones.
+func FindSettings(path string) (Settings, error) {
+	f := newPluginFinder()
+	if err := f.find(path); err != nil {
+		return Settings{}, err
+	}
+	return f.settings, nil
+}
+
+type pluginFinder struct {
+	visited      map[string]bool
+	declarations []Declaration
+	settings     Settings
+}
+
+func newPluginFinder() *pluginFinder {
+	return &pluginFinder{
+		visited: make(map[string]bool),
+		settings: Settings{
+			Options:     make(map[string]string),
+			Environment: make(map[string]string),
+		},
+	}
+}
+
+func (f *pluginFinder) find(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to determine absolute path of "+path+": %w", err)
+	}
+	if f.visited[absPath] {
+		return nil
+	}
+	f.visited[absPath] = true
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	config, err := Parse(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", absPath, err)
+	}
+
+	return f.walk(absPath, config.Nodes)
+}
+
+func (f *pluginFinder) walk(path string, nodes []Node) error {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case Command:
+			if err := f.command(path, n); err != nil {
+				return err
+			}
+		case Conditional:
+			for _, branch := range selectBranches(n) {
+				if err := f.walk(path, branch); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (f *pluginFinder) command(path string, cmd Command) error {
+	switch cmd.Name {
+	case "source", "source-file":
+		return f.findSourced(path, cmd.StartLine, cmd.Args)
+	case "setenv", "set-environment":
+		f.setEnvironment(cmd.Args)
+		return nil
+	}
+
+	opt, ok := cmd.Option()
+	if !ok {
+		return nil
+	}
+	if opt.Unset {
+		delete(f.settings.Options, opt.Name)
+		return nil
+	}
+	switch opt.Name {
+	case "@plugin":
+		if plugin := strings.TrimSpace(opt.Value); plugin != "" {
+			f.declarations = append(f.declarations, Declaration{Plugin: plugin, File: path, Line: cmd.StartLine})
+		}
+	case "@tpm_plugins":
+		// legacy tpm option that lists all the plugins separated by whitespace
+		for _, plugin := range strings.Fields(opt.Value) {
+			f.declarations = append(f.declarations, Declaration{Plugin: plugin, File: path, Line: cmd.StartLine})
+		}
+	default:
+		if strings.HasPrefix(opt.Name, "@") && !(opt.OnlyIfUnset && f.hasOption(opt.Name)) {
+			f.settings.Options[opt.Name] = opt.Value
+		}
+	}
+	return nil
+}
+
+func (f *pluginFinder) hasOption(name string) bool {
+	_, ok := f.settings.Options[name]
+	return ok
+}
+
+// setEnvironment records the variable set globally by a set-environment command.
+func (f *pluginFinder) setEnvironment(args []string) {
+	global := false
+	unset := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		flags := args[0][1:]
+		args = args[1:]
+		if flags == "-" {
+			break
+		}
+		for _, flag := range flags {
+			switch flag {
+			case 'g':
+				global = true
+			case 'r', 'u':
+				unset = true
+			case 't':
+				if len(args) > 0 {
+					args = args[1:]
+				}
+			}
+		}
+	}
+	if !global || len(args) == 0 {
+		return
+	}
+	if unset || len(args) == 1 {
+		delete(f.settings.Environment, args[0])
+		return
+	}
+	f.settings.Environment[args[0]] = args[1]
+}
+
+// selectBranches returns the blocks of the conditional that could be taken. Conditions that are
+// formats (#{...}) can only be evaluated by a running tmux server, so every block that could be
+// taken after such a condition is returned.
+func selectBranches(c Conditional) [][]Node {
+	var branches [][]Node
+	for _, branch := range c.Branches {
+		if strings.Contains(branch.Condition, "#{") {
+			branches = append(branches, branch.Nodes)
+			continue
+		}
+		if branch.Condition != "" && branch.Condition != "0" {
+			return append(branches, branch.Nodes)
+		}
+	}
+	return append(branches, c.Else)
+}
+
+func (f *pluginFinder) findSourced(path string, lineNumber int, args []string) error {
+	quiet := false
+	var patterns []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-t":
+			// the target pane is not relevant for finding the file
+			i++
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			if strings.Contains(arg, "n") {
+				// the file is only parsed, not executed
+				return nil
+			}
+			quiet = quiet || strings.Contains(arg, "q")
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+
+	for _, pattern := range patterns {
+		files, err := expandSourcePath(filepath.Dir(path), pattern)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		if len(files) == 0 {
+			if quiet {
+				continue
+			}
+			return fmt.Errorf("%s:%d: no such file: %s", path, lineNumber, pattern)
+		}
+		for _, file := range files {
+			if err = f.find(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandSourcePath expands ~ and glob patterns in the path of a sourced file. Only paths that
+// exist are returned.
+func expandSourcePath(dir string, path string) ([]string, error) {
+	path = expandHome(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern "+path+": %w", err)
+		}
+		return matches, nil
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to check if file exists: %w", err)
+	}
+	return []string{path}, nil
+}
@@ -0,0 +1,284 @@
+package tmux
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Edit replaces lines of a tmux conf file. Every other line is kept as is, so comments,
+// whitespace and the order of the file are preserved.
+type Edit struct {
+	// StartLine and EndLine are the first and last line (starting at 1) replaced. When EndLine is
+	// before StartLine, nothing is replaced and the lines are inserted before StartLine.
+	StartLine int
+	EndLine   int
+	// Lines are the lines replacing them, without line endings. No lines removes them.
+	Lines []string
+}
+
+// SplitLines splits the contents of a tmux conf file into lines without their line endings.
+func SplitLines(src []byte) []string {
+	s := strings.TrimSuffix(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// ApplyEdits applies the edits to the contents of a tmux conf file. Edits cannot overlap. The
+// line endings of the file (\n or \r\n) are kept.
+func ApplyEdits(src []byte, edits []Edit) ([]byte, error) {
+	lines := SplitLines(src)
+	edits = slices.Clone(edits)
+	// edits are applied from the end of the file so the lines of the others do not move, and an
+	// insertion is applied after a replacement of the same line
+	slices.SortFunc(edits, func(a, b Edit) int {
+		if a.StartLine != b.StartLine {
+			return b.StartLine - a.StartLine
+		}
+		return b.EndLine - a.EndLine
+	})
+	for i, e := range edits {
+		if e.StartLine < 1 || e.StartLine > len(lines)+1 || e.EndLine > len(lines) {
+			return nil, errors.New("lines " + strconv.Itoa(e.StartLine) + " to " + strconv.Itoa(e.EndLine) + " are not in the file")
+		}
+		if i > 0 && max(e.StartLine-1, e.EndLine) >= edits[i-1].StartLine {
+			return nil, fmt.Errorf("edit of line %d overlaps edit of line %d", e.StartLine, edits[i-1].StartLine)
+		}
+	}
+	for _, e := range edits {
+		lines = slices.Replace(lines, e.StartLine-1, max(e.EndLine, e.StartLine-1), e.Lines...)
+	}
+
+	newline := "\n"
+	if strings.Contains(string(src), "\r\n") {
+		newline = "\r\n"
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(lines, newline) + newline), nil
+}
+
+// ErrSystemConfig is returned when editing the system tmux conf file, which is shared by every
+// user. It is only read.
+var ErrSystemConfig = errors.New("the system tmux conf file " + SystemConfigPath + " is not edited, create ~/.config/tmux/tmux.conf or pass --config")
+
+// CheckEditable returns ErrSystemConfig when the tmux conf file at the path is the system tmux
+// conf file.
+func CheckEditable(path string) error {
+	if filepath.Clean(path) == SystemConfigPath {
+		return ErrSystemConfig
+	}
+	return nil
+}
+
+// BackupFile copies the tmux conf file at the path to <path>.bak (or <path>.bak.N when that exists
+// already) and returns the path of the copy.
+func BackupFile(path string) (string, error) {
+	if err := CheckEditable(path); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	backupPath := path + ".bak"
+	for n := 1; ; n++ {
+		if _, err = os.Lstat(backupPath); os.IsNotExist(err) {
+			break
+		}
+		backupPath = path + ".bak." + strconv.Itoa(n)
+	}
+	if err = os.WriteFile(backupPath, original, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return backupPath, nil
+}
+
+// WriteFile replaces the tmux conf file at the path with the contents, keeping its permissions.
+// When the path is a symlink (e.g. into a dotfiles repository), the file it links to is replaced
+// and the symlink is kept.
+func WriteFile(path string, content []byte) error {
+	if err := CheckEditable(path); err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// write to a temporary file first so the tmux conf file is never left half written
+	tmp, err := os.CreateTemp(filepath.Dir(resolved), "."+filepath.Base(resolved)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), resolved)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// OwnsLines determines if the command is the only statement on its lines, so they can be
+// rewritten without touching anything else.
+func OwnsLines(lines []string, cmd Command) bool {
+	if cmd.StartLine < 1 || cmd.EndLine > len(lines) {
+		return false
+	}
+	first := strings.TrimSpace(lines[cmd.StartLine-1])
+	return strings.HasPrefix(first, cmd.Name) && !strings.Contains(strings.Join(lines[cmd.StartLine-1:cmd.EndLine], "\n"), ";")
+}
+
+// AddPlugins declares the plugins in the tmux conf file at the path with set -g @plugin, in a
+// single write, and returns the line the first one is declared on. They are declared after the
+// last plugin before the run 'gtpm source' line, or right above that line when no plugin is.
+// Without the line, they are declared after the last plugin or at the end of the file.
+//
+// Only statements outside of %if blocks are considered, so the plugins are never declared
+// conditionally.
+func AddPlugins(path string, plugins []string) (int, error) {
+	if err := CheckEditable(path); err != nil {
+		return 0, err
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	config, err := Parse(bytes.NewReader(src))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	lastPlugin, sourceLine := 0, 0
+	for _, node := range config.Nodes {
+		if _, ok := FindPluginManager(node, "gtpm"); ok {
+			sourceLine, _ = node.Lines()
+			break
+		}
+		if cmd, ok := node.(Command); ok {
+			if opt, ok := cmd.Option(); ok && (opt.Name == "@plugin" || opt.Name == "@tpm_plugins") {
+				lastPlugin = cmd.EndLine
+			}
+		}
+	}
+
+	line := len(SplitLines(src)) + 1
+	switch {
+	case lastPlugin > 0:
+		line = lastPlugin + 1
+	case sourceLine > 0:
+		line = sourceLine
+	}
+	edit := Edit{StartLine: line, EndLine: line - 1}
+	for _, plugin := range plugins {
+		edit.Lines = append(edit.Lines, "set -g @plugin "+quote(plugin))
+	}
+	content, err := ApplyEdits(src, []Edit{edit})
+	if err != nil {
+		return 0, err
+	}
+	return line, WriteFile(path, content)
+}
+
+// quote quotes the argument so tmux reads it back as is.
+func quote(arg string) string {
+	if !strings.Contains(arg, "'") {
+		return "'" + arg + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// RemovePlugins removes the declarations of plugins from the tmux conf files they are declared in.
+// Every other line is kept as is. A declaration can only be removed when it is the only statement
+// on its lines and declares a single plugin (not @tpm_plugins).
+func RemovePlugins(declarations []Declaration) error {
+	var files []string
+	byFile := make(map[string][]Declaration)
+	for _, d := range declarations {
+		if err := CheckEditable(d.File); err != nil {
+			return fmt.Errorf("%s:%d: cannot remove %s: %w", d.File, d.Line, d.Plugin, err)
+		}
+		if _, ok := byFile[d.File]; !ok {
+			files = append(files, d.File)
+		}
+		byFile[d.File] = append(byFile[d.File], d)
+	}
+
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		config, err := Parse(bytes.NewReader(src))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		commands := make(map[int]Command)
+		collectCommands(config.Nodes, commands)
+
+		lines := SplitLines(src)
+		var edits []Edit
+		for _, d := range byFile[path] {
+			cmd, ok := commands[d.Line]
+			opt, isOption := cmd.Option()
+			if !ok || !isOption || opt.Name != "@plugin" || !OwnsLines(lines, cmd) {
+				return fmt.Errorf("%s:%d: cannot remove %s, remove it by hand", path, d.Line, d.Plugin)
+			}
+			if !slices.ContainsFunc(edits, func(e Edit) bool { return e.StartLine == cmd.StartLine }) {
+				edits = append(edits, Edit{StartLine: cmd.StartLine, EndLine: cmd.EndLine})
+			}
+		}
+
+		content, err := ApplyEdits(src, edits)
+		if err != nil {
+			return err
+		}
+		if err = WriteFile(path, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectCommands records the commands of the nodes, including the commands in every block of
+// conditionals, by the line they start on.
+func collectCommands(nodes []Node, commands map[int]Command) {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case Command:
+			commands[n.StartLine] = n
+		case Conditional:
+			for _, branch := range n.Branches {
+				collectCommands(branch.Nodes, commands)
+			}
+			collectCommands(n.Else, commands)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package tmux_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Piszmog/gtpm/tmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyEdits(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		edits    []tmux.Edit
+		expected string
+		err      string
+	}{
+		{
+			name:     "Replace",
+			src:      "# comment\nset -g mouse on\nrun 'x'\n",
+			edits:    []tmux.Edit{{StartLine: 3, EndLine: 3, Lines: []string{"run 'gtpm source'"}}},
+			expected: "# comment\nset -g mouse on\nrun 'gtpm source'\n",
+		},
+		{
+			name: "Insert",
+			src:  "a\nb\n",
+			edits: []tmux.Edit{
+				{StartLine: 3, EndLine: 2, Lines: []string{"c"}},
+				{StartLine: 1, EndLine: 0, Lines: []string{"0"}},
+			},
+			expected: "0\na\nb\nc\n",
+		},
+		{
+			name:     "Remove",
+			src:      "a\nb \\\n  c\nd\n",
+			edits:    []tmux.Edit{{StartLine: 2, EndLine: 3}},
+			expected: "a\nd\n",
+		},
+		{
+			name: "Replace And Insert Same Line",
+			src:  "a\nb\n",
+			edits: []tmux.Edit{
+				{StartLine: 2, EndLine: 1, Lines: []string{"x"}},
+				{StartLine: 2, EndLine: 2, Lines: []string{"y"}},
+			},
+			expected: "a\nx\ny\n",
+		},
+		{
+			name:     "CRLF",
+			src:      "a\r\nb\r\n",
+			edits:    []tmux.Edit{{StartLine: 2, EndLine: 2, Lines: []string{"c"}}},
+			expected: "a\r\nc\r\n",
+		},
+		{
+			name:     "No Trailing Newline",
+			src:      "a\nb",
+			edits:    []tmux.Edit{{StartLine: 3, EndLine: 2, Lines: []string{"c"}}},
+			expected: "a\nb\nc\n",
+		},
+		{
+			name: "Overlap",
+			src:  "a\nb\nc\n",
+			edits: []tmux.Edit{
+				{StartLine: 1, EndLine: 2},
+				{StartLine: 2, EndLine: 3},
+			},
+			err: "edit of line 1 overlaps edit of line 2",
+		},
+		{
+			name:  "Out Of Range",
+			src:   "a\n",
+			edits: []tmux.Edit{{StartLine: 2, EndLine: 2}},
+			err:   "lines 2 to 2 are not in the file",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := tmux.ApplyEdits([]byte(test.src), test.edits)
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+		})
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tmux.conf")
+	require.NoError(t, os.WriteFile(path, []byte("a\n"), 0o600))
+
+	backupPath, err := tmux.BackupFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, path+".bak", backupPath)
+	require.NoError(t, tmux.WriteFile(path, []byte("b\n")))
+	backupPath, err = tmux.BackupFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, path+".bak.1", backupPath)
+	require.NoError(t, tmux.WriteFile(path, []byte("c\n")))
+
+	for p, expected := range map[string]string{path: "c\n", path + ".bak": "a\n", path + ".bak.1": "b\n"} {
+		actual, err := os.ReadFile(p)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(actual), p)
+	}
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestWriteFile_Symlink(t *testing.T) {
+	dotfiles := filepath.Join(t.TempDir(), "tmux.conf")
+	require.NoError(t, os.WriteFile(dotfiles, []byte("set -g @plugin 'a/b'\n"), 0o640))
+	path := filepath.Join(t.TempDir(), "tmux.conf")
+	require.NoError(t, os.Symlink(dotfiles, path))
+
+	_, err := tmux.AddPlugins(path, []string{"c/d"})
+	require.NoError(t, err)
+
+	info, err := os.Lstat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+	actual, err := os.ReadFile(dotfiles)
+	require.NoError(t, err)
+	assert.Equal(t, "set -g @plugin 'a/b'\nset -g @plugin 'c/d'\n", string(actual))
+	info, err = os.Stat(dotfiles)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(dotfiles))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSystemConfig(t *testing.T) {
+	assert.NoError(t, tmux.CheckEditable("/home/me/.tmux.conf"))
+	assert.ErrorIs(t, tmux.CheckEditable(tmux.SystemConfigPath), tmux.ErrSystemConfig)
+	assert.ErrorIs(t, tmux.CheckEditable("/etc/../etc/tmux.conf"), tmux.ErrSystemConfig)
+
+	// the system tmux conf file is refused before it is read
+	_, err := tmux.BackupFile(tmux.SystemConfigPath)
+	assert.ErrorIs(t, err, tmux.ErrSystemConfig)
+	assert.ErrorIs(t, tmux.WriteFile(tmux.SystemConfigPath, nil), tmux.ErrSystemConfig)
+	_, err = tmux.AddPlugins(tmux.SystemConfigPath, []string{"a/b"})
+	assert.ErrorIs(t, err, tmux.ErrSystemConfig)
+	err = tmux.RemovePlugins([]tmux.Declaration{{Plugin: "a/b", File: tmux.SystemConfigPath, Line: 1}})
+	assert.ErrorIs(t, err, tmux.ErrSystemConfig)
+}
+
+func TestAddPlugins(t *testing.T) {
+	tests := []struct {
+		name         string
+		conf         string
+		plugins      []string
+		expected     string
+		expectedLine int
+	}{
+		{
+			name: "After Last Plugin",
+			conf: `# List of plugins
+set -g @plugin 'tmux-plugins/tmux-sensible'  # defaults
+
+# Initialize gtpm
+run 'gtpm source'
+`,
+			plugins: []string{"tmux-plugins/tmux-yank#v2.3.0", "tmux-plugins/tmux-resurrect"},
+			expected: `# List of plugins
+set -g @plugin 'tmux-plugins/tmux-sensible'  # defaults
+set -g @plugin 'tmux-plugins/tmux-yank#v2.3.0'
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+
+# Initialize gtpm
+run 'gtpm source'
+`,
+			expectedLine: 3,
+		},
+		{
+			name:         "Above Source",
+			conf:         "set -g mouse on\n\trun -b '/usr/local/bin/gtpm source'\n",
+			plugins:      []string{"tmux-plugins/tmux-yank"},
+			expected:     "set -g mouse on\nset -g @plugin 'tmux-plugins/tmux-yank'\n\trun -b '/usr/local/bin/gtpm source'\n",
+			expectedLine: 2,
+		},
+		{
+			name: "Ignores Plugins After Source",
+			conf: `set -g @plugin 'tmux-plugins/tmux-sensible'
+%if "#{==:#{host},work}"
+run 'gtpm source'
+%endif
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+`,
+			plugins: []string{"tmux-plugins/tmux-yank"},
+			expected: `set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+%if "#{==:#{host},work}"
+run 'gtpm source'
+%endif
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+`,
+			expectedLine: 2,
+		},
+		{
+			name:         "Source Alias",
+			conf:         "set -g mouse on\nrun 'gtpm s'\n",
+			plugins:      []string{"tmux-plugins/tmux-yank"},
+			expected:     "set -g mouse on\nset -g @plugin 'tmux-plugins/tmux-yank'\nrun 'gtpm s'\n",
+			expectedLine: 2,
+		},
+		{
+			name:         "End Of File",
+			conf:         "set -g mouse on",
+			plugins:      []string{"~/it's/plugin"},
+			expected:     "set -g mouse on\nset -g @plugin \"~/it's/plugin\"\n",
+			expectedLine: 2,
+		},
+		{
+			name:         "CRLF",
+			conf:         "set -g @plugin 'a/b'\r\nrun 'gtpm source'\r\n",
+			plugins:      []string{"c/d"},
+			expected:     "set -g @plugin 'a/b'\r\nset -g @plugin 'c/d'\r\nrun 'gtpm source'\r\n",
+			expectedLine: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tmux.conf")
+			require.NoError(t, os.WriteFile(path, []byte(test.conf), 0o644))
+
+			line, err := tmux.AddPlugins(path, test.plugins)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedLine, line)
+			actual, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			plugins, err := tmux.GetPlugins(path)
+			require.NoError(t, err)
+			assert.Subset(t, plugins, test.plugins)
+		})
+	}
+}
+
+func TestRemovePlugins(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     string
+		remove   []string
+		expected string
+		err      string
+	}{
+		{
+			name: "Remove",
+			conf: `# plugins
+set -g @plugin 'tmux-plugins/tmux-sensible'
+  set -g @plugin \
+    'tmux-plugins/tmux-yank'   # copy
+%if 1
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+%endif
+run 'gtpm source'
+`,
+			remove: []string{"tmux-plugins/tmux-yank", "tmux-plugins/tmux-resurrect"},
+			expected: `# plugins
+set -g @plugin 'tmux-plugins/tmux-sensible'
+%if 1
+%endif
+run 'gtpm source'
+`,
+		},
+		{
+			name:   "Shared Line",
+			conf:   "set -g @plugin 'tmux-plugins/tmux-yank'; set -g mouse on\n",
+			remove: []string{"tmux-plugins/tmux-yank"},
+			err:    "cannot remove tmux-plugins/tmux-yank, remove it by hand",
+		},
+		{
+			name:   "Legacy List",
+			conf:   "set -g @tpm_plugins 'tmux-plugins/tmux-yank tmux-plugins/tmux-sensible'\n",
+			remove: []string{"tmux-plugins/tmux-yank"},
+			err:    "cannot remove tmux-plugins/tmux-yank, remove it by hand",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tmux.conf")
+			require.NoError(t, os.WriteFile(path, []byte(test.conf), 0o644))
+
+			declarations, err := tmux.FindPlugins(path)
+			require.NoError(t, err)
+			var remove []tmux.Declaration
+			for _, d := range declarations {
+				if slices.Contains(test.remove, d.Plugin) {
+					remove = append(remove, d)
+				}
+			}
+
+			err = tmux.RemovePlugins(remove)
+			actual, readErr := os.ReadFile(path)
+			require.NoError(t, readErr)
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				assert.Equal(t, test.conf, string(actual))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+		})
+	}
+}
@@ -0,0 +1,566 @@
+package tmux
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Config is a parsed tmux conf file.
+type Config struct {
+	Nodes []Node
+}
+
+// Node is a statement in a tmux conf file. It is either a Command, Assignment or Conditional.
+type Node interface {
+	// Lines returns the first and last line (starting at 1) the statement is on.
+	Lines() (int, int)
+}
+
+// Command is a tmux command, such as set-option or source-file.
+type Command struct {
+	// Name is the name of the command as written (e.g. set, set-option).
+	Name string
+	// Args are the arguments of the command with quotes removed and escapes, ~ and environment
+	// variables expanded. The contents of a {} block is a single argument.
+	Args      []string
+	StartLine int
+	EndLine   int
+}
+
+// Lines returns the first and last line the command is on.
+func (c Command) Lines() (int, int) {
+	return c.StartLine, c.EndLine
+}
+
+// Assignment sets an environment variable (NAME=value or %hidden NAME=value).
+type Assignment struct {
+	Name      string
+	Value     string
+	Hidden    bool
+	StartLine int
+	EndLine   int
+}
+
+// Lines returns the first and last line the assignment is on.
+func (a Assignment) Lines() (int, int) {
+	return a.StartLine, a.EndLine
+}
+
+// Conditional is a %if block with any %elif and %else blocks.
+type Conditional struct {
+	// Branches are the %if block followed by the %elif blocks.
+	Branches []Branch
+	// Else are the statements in the %else block.
+	Else      []Node
+	StartLine int
+	EndLine   int
+}
+
+// Lines returns the line of the %if and the line of the %endif.
+func (c Conditional) Lines() (int, int) {
+	return c.StartLine, c.EndLine
+}
+
+// Branch is a %if or %elif block.
+type Branch struct {
+	// Condition is the format that is evaluated to determine if the branch is taken.
+	Condition string
+	Nodes     []Node
+}
+
+// Option is a set-option command.
+type Option struct {
+	// Name is the name of the option (e.g. @plugin, status).
+	Name string
+	// Value is the value of the option. It is empty when the option is unset.
+	Value string
+	// Target is the target of the option (-t).
+	Target string
+	// Global is set with -g.
+	Global bool
+	// Append is set with -a.
+	Append bool
+	// Unset is set with -u or -U.
+	Unset bool
+	// Server is set with -s.
+	Server bool
+	// Window is set with -w or by using set-window-option.
+	Window bool
+	// Pane is set with -p.
+	Pane bool
+	// OnlyIfUnset is set with -o.
+	OnlyIfUnset bool
+	// Format is set with -F.
+	Format bool
+	// Quiet is set with -q.
+	Quiet bool
+}
+
+// Option returns the option set by the command. If the command is not a set-option command,
+// false is returned.
+func (c Command) Option() (Option, bool) {
+	var opt Option
+	switch c.Name {
+	case "set", "set-option":
+	case "setw", "set-window-option":
+		opt.Window = true
+	default:
+		return Option{}, false
+	}
+
+	args := c.Args
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		flags := args[0][1:]
+		args = args[1:]
+		if flags == "-" {
+			break
+		}
+		for _, flag := range flags {
+			switch flag {
+			case 'a':
+				opt.Append = true
+			case 'F':
+				opt.Format = true
+			case 'g':
+				opt.Global = true
+			case 'o':
+				opt.OnlyIfUnset = true
+			case 'p':
+				opt.Pane = true
+			case 'q':
+				opt.Quiet = true
+			case 's':
+				opt.Server = true
+			case 'u', 'U':
+				opt.Unset = true
+			case 'w':
+				opt.Window = true
+			case 't':
+				if len(args) > 0 {
+					opt.Target = args[0]
+					args = args[1:]
+				}
+			}
+		}
+	}
+
+	if len(args) == 0 {
+		return Option{}, false
+	}
+	opt.Name = args[0]
+	if len(args) > 1 {
+		opt.Value = args[1]
+	}
+	return opt, true
+}
+
+// Parse parses the contents of a tmux conf file.
+//
+// Environment variables are expanded from the assignments in the file first, then from the
+// environment of the process.
+func Parse(r io.Reader) (Config, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	p := &parser{src: []rune(string(src)), line: 1, env: make(map[string]string)}
+	nodes, end, err := p.parseBlock()
+	if err != nil {
+		return Config{}, err
+	}
+	if end != "" {
+		return Config{}, fmt.Errorf("line %d: unexpected %s", p.pendingLine, end)
+	}
+	return Config{Nodes: nodes}, nil
+}
+
+type parser struct {
+	src  []rune
+	pos  int
+	line int
+	env  map[string]string
+	// pendingArgs are the arguments of the directive that ended the last block.
+	pendingArgs []string
+	// pendingLine is the line of the directive that ended the last block.
+	pendingLine int
+}
+
+func (p *parser) peek(offset int) rune {
+	if p.pos+offset >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos+offset]
+}
+
+func (p *parser) next() rune {
+	r := p.src[p.pos]
+	p.pos++
+	if r == '\n' {
+		p.line++
+	}
+	return r
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+// parseBlock parses statements until the end of the file or a %elif, %else or %endif directive,
+// which is returned.
+func (p *parser) parseBlock() ([]Node, string, error) {
+	var nodes []Node
+	for {
+		p.skipSeparators()
+		if p.eof() {
+			return nodes, "", nil
+		}
+
+		if p.peek(0) == '%' {
+			startLine := p.line
+			directive, args, err := p.parseLine()
+			if err != nil {
+				return nil, "", err
+			}
+			switch directive {
+			case "%if":
+				node, err := p.parseConditional(startLine, args)
+				if err != nil {
+					return nil, "", err
+				}
+				nodes = append(nodes, node)
+			case "%elif", "%else", "%endif":
+				p.pendingArgs = args
+				p.pendingLine = startLine
+				return nodes, directive, nil
+			case "%hidden":
+				if len(args) != 1 {
+					return nil, "", fmt.Errorf("line %d: expected %%hidden NAME=value", startLine)
+				}
+				name, value, ok := parseAssignment(args[0])
+				if !ok {
+					return nil, "", fmt.Errorf("line %d: expected %%hidden NAME=value", startLine)
+				}
+				p.env[name] = value
+				nodes = append(nodes, Assignment{Name: name, Value: value, Hidden: true, StartLine: startLine, EndLine: p.endLine()})
+			default:
+				return nil, "", fmt.Errorf("line %d: unknown directive %s", startLine, directive)
+			}
+			continue
+		}
+
+		startLine := p.line
+		name, args, err := p.parseLine()
+		if err != nil {
+			return nil, "", err
+		}
+		if name == "" {
+			continue
+		}
+		if len(args) == 0 {
+			if varName, value, ok := parseAssignment(name); ok {
+				p.env[varName] = value
+				nodes = append(nodes, Assignment{Name: varName, Value: value, StartLine: startLine, EndLine: p.endLine()})
+				continue
+			}
+		}
+		nodes = append(nodes, Command{Name: name, Args: args, StartLine: startLine, EndLine: p.endLine()})
+	}
+}
+
+func (p *parser) parseConditional(startLine int, args []string) (Conditional, error) {
+	if len(args) != 1 {
+		return Conditional{}, fmt.Errorf("line %d: expected %%if to have one condition", startLine)
+	}
+	conditional := Conditional{StartLine: startLine}
+	condition := args[0]
+	for {
+		nodes, end, err := p.parseBlock()
+		if err != nil {
+			return Conditional{}, err
+		}
+		conditional.Branches = append(conditional.Branches, Branch{Condition: condition, Nodes: nodes})
+
+		switch end {
+		case "%elif":
+			if len(p.pendingArgs) != 1 {
+				return Conditional{}, fmt.Errorf("line %d: expected %%elif to have one condition", p.pendingLine)
+			}
+			condition = p.pendingArgs[0]
+			continue
+		case "%else":
+			elseNodes, end, err := p.parseBlock()
+			if err != nil {
+				return Conditional{}, err
+			}
+			if end != "%endif" {
+				return Conditional{}, fmt.Errorf("line %d: missing %%endif for %%if on line %d", p.line, startLine)
+			}
+			conditional.Else = elseNodes
+		case "%endif":
+		default:
+			return Conditional{}, fmt.Errorf("line %d: missing %%endif for %%if on line %d", p.line, startLine)
+		}
+		conditional.EndLine = p.endLine()
+		return conditional, nil
+	}
+}
+
+// endLine returns the line the last statement ended on. The terminating newline has already
+// been consumed when the statement ended with one.
+func (p *parser) endLine() int {
+	if p.pos > 0 && p.src[p.pos-1] == '\n' {
+		return p.line - 1
+	}
+	return p.line
+}
+
+// skipSeparators skips whitespace, empty lines, command separators and comments between statements.
+func (p *parser) skipSeparators() {
+	for !p.eof() {
+		switch r := p.peek(0); {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == ';':
+			p.next()
+		case r == '\\' && p.peek(1) == '\n':
+			p.next()
+			p.next()
+		case r == '#' && p.peek(1) != '{':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) skipComment() {
+	for !p.eof() && p.peek(0) != '\n' {
+		p.next()
+	}
+}
+
+// parseLine parses the words of a single statement. The statement ends at an unquoted newline,
+// semicolon or comment.
+func (p *parser) parseLine() (string, []string, error) {
+	var words []string
+	for {
+		for !p.eof() && (p.peek(0) == ' ' || p.peek(0) == '\t' || p.peek(0) == '\r') {
+			p.next()
+		}
+		if p.eof() {
+			break
+		}
+
+		r := p.peek(0)
+		if r == '\n' || r == ';' {
+			p.next()
+			break
+		}
+		if r == '#' && p.peek(1) != '{' {
+			p.skipComment()
+			continue
+		}
+		if r == '\\' && p.peek(1) == '\n' {
+			p.next()
+			p.next()
+			continue
+		}
+
+		word, err := p.parseWord()
+		if err != nil {
+			return "", nil, err
+		}
+		words = append(words, word)
+	}
+
+	if len(words) == 0 {
+		return "", nil, nil
+	}
+	return words[0], words[1:], nil
+}
+
+// parseWord parses a single word, removing quotes and expanding escapes, ~ and environment variables.
+func (p *parser) parseWord() (string, error) {
+	if p.peek(0) == '{' {
+		return p.parseBraces()
+	}
+
+	var sb strings.Builder
+	start := true
+	for !p.eof() {
+		r := p.peek(0)
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == ';':
+			return sb.String(), nil
+		case r == '\\':
+			p.next()
+			if p.eof() {
+				return sb.String(), nil
+			}
+			if p.peek(0) == '\n' {
+				p.next()
+				continue
+			}
+			sb.WriteRune(p.next())
+		case r == '\'':
+			p.next()
+			if err := p.parseSingleQuoted(&sb); err != nil {
+				return "", err
+			}
+		case r == '"':
+			p.next()
+			if err := p.parseDoubleQuoted(&sb); err != nil {
+				return "", err
+			}
+		case r == '$':
+			p.next()
+			sb.WriteString(p.parseVariable())
+		case r == '~' && start:
+			p.next()
+			if p.eof() || strings.ContainsRune(" \t\r\n;/", p.peek(0)) {
+				sb.WriteString(p.getenv("HOME"))
+			} else {
+				sb.WriteRune('~')
+			}
+		default:
+			sb.WriteRune(p.next())
+		}
+		start = false
+	}
+	return sb.String(), nil
+}
+
+func (p *parser) parseSingleQuoted(sb *strings.Builder) error {
+	startLine := p.line
+	for !p.eof() {
+		r := p.next()
+		if r == '\'' {
+			return nil
+		}
+		sb.WriteRune(r)
+	}
+	return fmt.Errorf("line %d: unterminated single quote", startLine)
+}
+
+func (p *parser) parseDoubleQuoted(sb *strings.Builder) error {
+	startLine := p.line
+	for !p.eof() {
+		r := p.next()
+		switch r {
+		case '"':
+			return nil
+		case '\\':
+			if p.eof() {
+				continue
+			}
+			escaped := p.next()
+			switch escaped {
+			case '\n':
+			case 'n':
+				sb.WriteRune('\n')
+			case 't':
+				sb.WriteRune('\t')
+			case 'r':
+				sb.WriteRune('\r')
+			case 'e':
+				sb.WriteRune('\033')
+			case '"', '\\', '$':
+				sb.WriteRune(escaped)
+			default:
+				sb.WriteRune('\\')
+				sb.WriteRune(escaped)
+			}
+		case '$':
+			sb.WriteString(p.parseVariable())
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return fmt.Errorf("line %d: unterminated double quote", startLine)
+}
+
+// parseVariable parses the name of an environment variable after a $ and returns its value.
+// A $ that is not followed by a variable name is kept as is.
+func (p *parser) parseVariable() string {
+	if p.peek(0) == '{' {
+		end := p.pos + 1
+		for end < len(p.src) && p.src[end] != '}' && p.src[end] != '\n' {
+			end++
+		}
+		if end >= len(p.src) || p.src[end] != '}' {
+			return "$"
+		}
+		name := string(p.src[p.pos+1 : end])
+		p.pos = end + 1
+		return p.getenv(name)
+	}
+
+	var name strings.Builder
+	for !p.eof() && isVariableRune(p.peek(0), name.Len() == 0) {
+		name.WriteRune(p.next())
+	}
+	if name.Len() == 0 {
+		return "$"
+	}
+	return p.getenv(name.String())
+}
+
+func (p *parser) getenv(name string) string {
+	if value, ok := p.env[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// parseBraces parses a {} block, returning its content as is.
+func (p *parser) parseBraces() (string, error) {
+	startLine := p.line
+	p.next()
+	start := p.pos
+	depth := 1
+	var quote rune
+	for !p.eof() {
+		r := p.next()
+		switch {
+		case quote != 0:
+			if r == '\\' && quote == '"' && !p.eof() {
+				p.next()
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '\\' && !p.eof():
+			p.next()
+		case r == '#' && p.peek(0) != '{':
+			p.skipComment()
+		case r == '{':
+			depth++
+		case r == '}':
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(string(p.src[start : p.pos-1])), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("line %d: unterminated {", startLine)
+}
+
+func isVariableRune(r rune, first bool) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (!first && r >= '0' && r <= '9')
+}
+
+// parseAssignment parses a NAME=value word.
+func parseAssignment(word string) (string, string, bool) {
+	name, value, found := strings.Cut(word, "=")
+	if !found || name == "" {
+		return "", "", false
+	}
+	for i, r := range name {
+		if !isVariableRune(r, i == 0) {
+			return "", "", false
+		}
+	}
+	return name, value, true
+}
@@ -0,0 +1,296 @@
+package tmux_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Piszmog/gtpm/tmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	tests := []struct {
+		name          string
+		rawFile       string
+		expectedNodes []tmux.Node
+		expectedErr   string
+	}{
+		{
+			name:          "Empty File",
+			rawFile:       ``,
+			expectedNodes: nil,
+		},
+		{
+			name:          "Only Comments",
+			rawFile:       "# comment\n   # indented comment\n",
+			expectedNodes: nil,
+		},
+		{
+			name:    "Command",
+			rawFile: `set -g default-terminal "xterm-256color"`,
+			expectedNodes: []tmux.Node{
+				tmux.Command{Name: "set", Args: []string{"-g", "default-terminal", "xterm-256color"}, StartLine: 1, EndLine: 1},
+			},
+		},
+		{
+			name:    "Quoting",
+			rawFile: `display 'single $HOME' "double $HOME \"quoted\"" unquoted\ space ~/path ${HOME}/braces a~b`,
+			expectedNodes: []tmux.Node{
+				tmux.Command{
+					Name: "display",
+					Args: []string{
+						"single $HOME",
+						`double /home/user "quoted"`,
+						"unquoted space",
+						"/home/user/path",
+						"/home/user/braces",
+						"a~b",
+					},
+					StartLine: 1,
+					EndLine:   1,
+				},
+			},
+		},
+		{
+			name:    "Formats Are Not Comments",
+			rawFile: `set -g status-right #{host} # comment`,
+			expectedNodes: []tmux.Node{
+				tmux.Command{Name: "set", Args: []string{"-g", "status-right", "#{host}"}, StartLine: 1, EndLine: 1},
+			},
+		},
+		{
+			name:    "Line Continuation",
+			rawFile: "set -g \\\n  mouse \\\n  on\nset -g status off\n",
+			expectedNodes: []tmux.Node{
+				tmux.Command{Name: "set", Args: []string{"-g", "mouse", "on"}, StartLine: 1, EndLine: 3},
+				tmux.Command{Name: "set", Args: []string{"-g", "status", "off"}, StartLine: 4, EndLine: 4},
+			},
+		},
+		{
+			name:    "Semicolons",
+			rawFile: `bind r source-file ~/.tmux.conf \; display "reloaded"; set -g mouse on`,
+			expectedNodes: []tmux.Node{
+				tmux.Command{
+					Name:      "bind",
+					Args:      []string{"r", "source-file", "/home/user/.tmux.conf", ";", "display", "reloaded"},
+					StartLine: 1,
+					EndLine:   1,
+				},
+				tmux.Command{Name: "set", Args: []string{"-g", "mouse", "on"}, StartLine: 1, EndLine: 1},
+			},
+		},
+		{
+			name:    "Braces",
+			rawFile: "bind x {\n  kill-pane # no prompt\n  display '}'\n}\nset -g mouse on",
+			expectedNodes: []tmux.Node{
+				tmux.Command{
+					Name:      "bind",
+					Args:      []string{"x", "kill-pane # no prompt\n  display '}'"},
+					StartLine: 1,
+					EndLine:   4,
+				},
+				tmux.Command{Name: "set", Args: []string{"-g", "mouse", "on"}, StartLine: 5, EndLine: 5},
+			},
+		},
+		{
+			name:    "Assignments",
+			rawFile: "THEME=dark\n%hidden SECRET=\"a b\"\nset -g @theme $THEME-$SECRET",
+			expectedNodes: []tmux.Node{
+				tmux.Assignment{Name: "THEME", Value: "dark", StartLine: 1, EndLine: 1},
+				tmux.Assignment{Name: "SECRET", Value: "a b", Hidden: true, StartLine: 2, EndLine: 2},
+				tmux.Command{Name: "set", Args: []string{"-g", "@theme", "dark-a b"}, StartLine: 3, EndLine: 3},
+			},
+		},
+		{
+			name: "Conditional",
+			rawFile: `%if "#{==:#{host},work}"
+set -g status-style bg=red
+%elif 1
+set -g status-style bg=blue
+%else
+set -g status-style bg=green
+%endif
+`,
+			expectedNodes: []tmux.Node{
+				tmux.Conditional{
+					Branches: []tmux.Branch{
+						{
+							Condition: "#{==:#{host},work}",
+							Nodes: []tmux.Node{
+								tmux.Command{Name: "set", Args: []string{"-g", "status-style", "bg=red"}, StartLine: 2, EndLine: 2},
+							},
+						},
+						{
+							Condition: "1",
+							Nodes: []tmux.Node{
+								tmux.Command{Name: "set", Args: []string{"-g", "status-style", "bg=blue"}, StartLine: 4, EndLine: 4},
+							},
+						},
+					},
+					Else: []tmux.Node{
+						tmux.Command{Name: "set", Args: []string{"-g", "status-style", "bg=green"}, StartLine: 6, EndLine: 6},
+					},
+					StartLine: 1,
+					EndLine:   7,
+				},
+			},
+		},
+		{
+			name:        "Unexpected endif",
+			rawFile:     "set -g mouse on\n%endif\n",
+			expectedErr: "line 2: unexpected %endif",
+		},
+		{
+			name:        "Unknown Directive",
+			rawFile:     "%unknown\n",
+			expectedErr: "line 1: unknown directive %unknown",
+		},
+		{
+			name:        "Unterminated Double Quote",
+			rawFile:     "set -g @plugin \"tmux-plugins/tmux-sensible\n",
+			expectedErr: "line 1: unterminated double quote",
+		},
+		{
+			name:        "Unterminated Brace",
+			rawFile:     "bind x {\n  kill-pane\n",
+			expectedErr: "line 1: unterminated {",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := tmux.Parse(strings.NewReader(test.rawFile))
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, test.expectedErr, err.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedNodes, config.Nodes)
+			}
+		})
+	}
+}
+
+func TestCommand_Option(t *testing.T) {
+	tests := []struct {
+		name           string
+		command        tmux.Command
+		expectedOption tmux.Option
+		expectedOk     bool
+	}{
+		{
+			name:           "Global",
+			command:        tmux.Command{Name: "set", Args: []string{"-g", "@plugin", "tmux-plugins/tmux-sensible"}},
+			expectedOption: tmux.Option{Name: "@plugin", Value: "tmux-plugins/tmux-sensible", Global: true},
+			expectedOk:     true,
+		},
+		{
+			name:           "Combined Flags",
+			command:        tmux.Command{Name: "set-option", Args: []string{"-gaqF", "status-right", "#{host}"}},
+			expectedOption: tmux.Option{Name: "status-right", Value: "#{host}", Global: true, Append: true, Quiet: true, Format: true},
+			expectedOk:     true,
+		},
+		{
+			name:           "Target",
+			command:        tmux.Command{Name: "set", Args: []string{"-t", "main", "-p", "@x", "1"}},
+			expectedOption: tmux.Option{Name: "@x", Value: "1", Target: "main", Pane: true},
+			expectedOk:     true,
+		},
+		{
+			name:           "Window Option",
+			command:        tmux.Command{Name: "setw", Args: []string{"-g", "mode-keys", "vi"}},
+			expectedOption: tmux.Option{Name: "mode-keys", Value: "vi", Global: true, Window: true},
+			expectedOk:     true,
+		},
+		{
+			name:           "Unset",
+			command:        tmux.Command{Name: "set", Args: []string{"-gu", "@plugin"}},
+			expectedOption: tmux.Option{Name: "@plugin", Global: true, Unset: true},
+			expectedOk:     true,
+		},
+		{
+			name:       "Missing Name",
+			command:    tmux.Command{Name: "set", Args: []string{"-g"}},
+			expectedOk: false,
+		},
+		{
+			name:       "Other Command",
+			command:    tmux.Command{Name: "bind", Args: []string{"r", "source-file", "~/.tmux.conf"}},
+			expectedOk: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opt, ok := test.command.Option()
+			assert.Equal(t, test.expectedOk, ok)
+			assert.Equal(t, test.expectedOption, opt)
+		})
+	}
+}
+
+func TestCommand_PluginManager(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  tmux.Command
+		expected string
+	}{
+		{
+			name:     "Source",
+			command:  tmux.Command{Name: "run", Args: []string{"gtpm source"}},
+			expected: "gtpm",
+		},
+		{
+			name:     "Source Alias In Background",
+			command:  tmux.Command{Name: "run-shell", Args: []string{"-b", "/usr/local/bin/gtpm s"}},
+			expected: "gtpm",
+		},
+		{
+			name:     "Other gtpm Command",
+			command:  tmux.Command{Name: "run", Args: []string{"gtpm install"}},
+			expected: "",
+		},
+		{
+			name:     "TPM",
+			command:  tmux.Command{Name: "run", Args: []string{"~/.tmux/plugins/tpm/tpm"}},
+			expected: "tpm",
+		},
+		{
+			name:     "Other Command",
+			command:  tmux.Command{Name: "bind", Args: []string{"r", "run", "gtpm source"}},
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.command.PluginManager())
+		})
+	}
+}
+
+func TestFindPluginManager(t *testing.T) {
+	config, err := tmux.Parse(strings.NewReader(`set -g mouse on
+%if "#{==:#{host},work}"
+run '~/.tmux/plugins/tpm/tpm'
+%elif 1
+run 'gtpm source'
+%else
+run -b 'gtpm s'
+%endif
+`))
+	require.NoError(t, err)
+	require.Len(t, config.Nodes, 2)
+
+	_, ok := tmux.FindPluginManager(config.Nodes[0], "gtpm")
+	assert.False(t, ok)
+	cmd, ok := tmux.FindPluginManager(config.Nodes[1], "gtpm")
+	assert.True(t, ok)
+	assert.Equal(t, 7, cmd.StartLine)
+	cmd, ok = tmux.FindPluginManager(config.Nodes[1], "tpm")
+	assert.True(t, ok)
+	assert.Equal(t, 3, cmd.StartLine)
+}
@@ -0,0 +1,88 @@
+package tmux
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// PluginManagerPathEnvVar is the environment variable tpm keeps the plugin directory in. Plugins
+	// use it to find each other, so gtpm sets it in the global environment of tmux as well.
+	PluginManagerPathEnvVar = "TMUX_PLUGIN_MANAGER_PATH"
+	// PluginDirOption is the option to set the plugin directory in the tmux conf file. It takes
+	// precedence over $TMUX_PLUGIN_MANAGER_PATH.
+	PluginDirOption = "@gtpm-plugin-dir"
+)
+
+// PluginsDir returns the directory the plugins of the tmux conf file at the path are installed
+// to. The first of these is used:
+//
+//   - the @gtpm-plugin-dir option in the tmux conf file
+//   - $TMUX_PLUGIN_MANAGER_PATH in the environment of the process
+//   - $TMUX_PLUGIN_MANAGER_PATH in the global environment of tmux, when client is not nil
+//   - $TMUX_PLUGIN_MANAGER_PATH set with set-environment -g in the tmux conf file
+//   - the plugins directory next to the tmux conf file when it is in the XDG layout
+//     (e.g. ~/.config/tmux/tmux.conf), otherwise ~/.tmux/plugins
+//
+// Relative directories are resolved from the directory of the tmux conf file.
+func PluginsDir(ctx context.Context, logger *slog.Logger, client Client, confPath string) (string, error) {
+	settings, err := FindSettings(confPath)
+	if err != nil {
+		return "", err
+	}
+	confDir := filepath.Dir(confPath)
+
+	if dir := settings.Options[PluginDirOption]; dir != "" {
+		logger.Debug("using plugin directory from option", "option", PluginDirOption, "path", dir)
+		return resolveDir(confDir, dir), nil
+	}
+	if dir := os.Getenv(PluginManagerPathEnvVar); dir != "" {
+		logger.Debug("using plugin directory from environment", "path", dir)
+		return resolveDir(confDir, dir), nil
+	}
+	if client != nil {
+		dir, isSet, err := client.ShowEnvironment(ctx, PluginManagerPathEnvVar)
+		if err != nil {
+			return "", err
+		}
+		if isSet && dir != "" {
+			logger.Debug("using plugin directory from tmux environment", "path", dir)
+			return resolveDir(confDir, dir), nil
+		}
+	}
+	if dir := settings.Environment[PluginManagerPathEnvVar]; dir != "" {
+		logger.Debug("using plugin directory from tmux conf file", "path", dir)
+		return resolveDir(confDir, dir), nil
+	}
+
+	if isXDGLayout(confPath) {
+		return filepath.Join(confDir, "plugins"), nil
+	}
+	return filepath.Join(os.Getenv("HOME"), ".tmux", "plugins"), nil
+}
+
+// isXDGLayout determines if the tmux conf file is $XDG_CONFIG_HOME/tmux/tmux.conf (or
+// ~/.config/tmux/tmux.conf), where tpm installs plugins next to it.
+func isXDGLayout(confPath string) bool {
+	return filepath.Base(confPath) == "tmux.conf" && filepath.Base(filepath.Dir(confPath)) == "tmux"
+}
+
+func resolveDir(confDir string, dir string) string {
+	dir = expandHome(strings.TrimSpace(dir))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(confDir, dir)
+	}
+	return filepath.Clean(dir)
+}
+
+// SetPluginManagerPath sets $TMUX_PLUGIN_MANAGER_PATH in the global environment of tmux to the
+// plugin directory, the way tpm does, so plugins relying on it find the directory.
+func SetPluginManagerPath(ctx context.Context, logger *slog.Logger, client Client, dir string) error {
+	// tpm always ends the path with a slash, and plugins rely on it
+	value := strings.TrimSuffix(dir, "/") + "/"
+	logger.Debug("setting plugin manager path", "path", value)
+	return client.SetEnvironment(ctx, PluginManagerPathEnvVar, value)
+}
@@ -0,0 +1,145 @@
+package tmux
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const (
+	// PopupEnvVar is set in the environment of gtpm when it runs inside a popup it opened itself.
+	PopupEnvVar = "GTPM_POPUP"
+	// PopupStatusEnvVar is the path of the file gtpm writes its exit code to when it runs inside a
+	// popup it opened itself, so the gtpm that opened the popup can exit with it.
+	PopupStatusEnvVar = "GTPM_POPUP_STATUS"
+)
+
+// Progress renders the status of every plugin while plugins are installed or updated, for the
+// output of run-shell or a popup.
+//
+// run-shell shows the output in the pane as it is written, so each change is written as a new
+// line. A popup is a terminal, so when live is set the status lines are redrawn in place.
+type Progress struct {
+	w     io.Writer
+	title string
+	live  bool
+
+	mu      sync.Mutex
+	plugins []string
+	status  map[string]string
+	drawn   int
+}
+
+// NewProgress creates a Progress writing to w. The title is written first (e.g. Installing
+// plugins).
+func NewProgress(w io.Writer, title string, live bool) *Progress {
+	p := &Progress{w: w, title: title, live: live, status: make(map[string]string)}
+	fmt.Fprintln(w, title)
+	fmt.Fprintln(w)
+	return p
+}
+
+// Start shows the plugin as being acted on.
+func (p *Progress) Start(plugin string, action string) {
+	p.set(plugin, action+"...")
+}
+
+// Done shows the outcome of the action on the plugin. The detail is written after the outcome
+// (e.g. the commits it moved between, or the error).
+func (p *Progress) Done(plugin string, outcome string, detail string) {
+	if detail != "" {
+		outcome += " (" + detail + ")"
+	}
+	p.set(plugin, outcome)
+}
+
+// Update shows the status of the plugin while it is acted on (e.g. how much has been cloned). It
+// is only shown when the status lines are redrawn in place, so the output of run-shell is not
+// flooded.
+func (p *Progress) Update(plugin string, status string) {
+	if !p.live {
+		return
+	}
+	p.set(plugin, status)
+}
+
+func (p *Progress) set(plugin string, status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.status[plugin]; !ok {
+		p.plugins = append(p.plugins, plugin)
+	}
+	p.status[plugin] = status
+
+	if !p.live {
+		fmt.Fprintf(p.w, "  %s: %s\n", plugin, status)
+		return
+	}
+	p.redraw()
+}
+
+// redraw moves the cursor back over the lines drawn before and draws the status of every plugin.
+func (p *Progress) redraw() {
+	var b strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dA", p.drawn)
+	}
+	for _, plugin := range p.plugins {
+		fmt.Fprintf(&b, "\033[2K  %s: %s\n", plugin, p.status[plugin])
+	}
+	p.drawn = len(p.plugins)
+	_, _ = io.WriteString(p.w, b.String())
+}
+
+// Finish writes the summary and asks to press ESC to continue. In a popup, it waits until a key
+// closing the popup is pressed. The output of run-shell is closed with ESC by tmux itself.
+func (p *Progress) Finish(summary string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.w)
+	fmt.Fprintln(p.w, summary)
+	fmt.Fprintln(p.w)
+	fmt.Fprintln(p.w, "Done, press ESC to continue.")
+	if !p.live {
+		return nil
+	}
+	return waitForEscape(os.Stdin)
+}
+
+// waitForEscape reads the terminal until ESC, q or enter is pressed. It returns straight away
+// when f is not a terminal.
+func waitForEscape(f *os.File) error {
+	if err := stty(f, "raw", "-echo"); err != nil {
+		// not a terminal, so there is no key to wait for
+		return nil
+	}
+	defer stty(f, "sane")
+
+	r := bufio.NewReader(f)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read key: %w", err)
+		}
+		switch b {
+		case '\033', 'q', '\r', '\n':
+			return nil
+		}
+	}
+}
+
+func stty(f *os.File, args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = f
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set terminal mode: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package tmux_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Piszmog/gtpm/tmux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		live     bool
+		expected string
+	}{
+		{
+			name: "Lines",
+			expected: "Installing plugins\n\n" +
+				"  tmux-sensible: clone...\n" +
+				"  tmux-yank: clone...\n" +
+				"  tmux-sensible: succeeded\n" +
+				"  tmux-yank: failed (remote repository not found)\n" +
+				"\n1 succeeded, 0 skipped, 1 failed\n\nDone, press ESC to continue.\n",
+		},
+		{
+			name: "Live",
+			live: true,
+			expected: "Installing plugins\n\n" +
+				"\033[2K  tmux-sensible: clone...\n" +
+				"\033[1A\033[2K  tmux-sensible: clone...\n\033[2K  tmux-yank: clone...\n" +
+				"\033[2A\033[2K  tmux-sensible: succeeded\n\033[2K  tmux-yank: clone...\n" +
+				"\033[2A\033[2K  tmux-sensible: succeeded\n\033[2K  tmux-yank: failed (remote repository not found)\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out strings.Builder
+			progress := tmux.NewProgress(&out, "Installing plugins", test.live)
+			progress.Start("tmux-sensible", "clone")
+			progress.Start("tmux-yank", "clone")
+			progress.Done("tmux-sensible", "succeeded", "")
+			progress.Done("tmux-yank", "failed", "remote repository not found")
+			if !test.live {
+				// a live progress waits for a key to be pressed
+				require.NoError(t, progress.Finish("1 succeeded, 0 skipped, 1 failed"))
+			}
+			assert.Equal(t, test.expected, out.String())
+		})
+	}
+}
@@ -1,89 +1,119 @@
 package tmux
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
+
+	"github.com/Piszmog/gtpm/git"
 )
 
-func GetConfigFilePath(logger *slog.Logger) (string, error) {
-	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+const (
+	// ConfigEnvVar is the environment variable to set the path of the tmux conf file with.
+	ConfigEnvVar = "TMUX_CONF"
+	// SystemConfigPath is the tmux conf file tmux loads for every user.
+	SystemConfigPath = "/etc/tmux.conf"
+)
 
-	var configPath string
-	if xdgConfigHome != "" {
-		logger.Debug("XDF_CONFIG_HOME is set")
-		configPath = filepath.Join(xdgConfigHome, "tmux", "tmux.conf")
+// FindConfigFile returns the path of the tmux conf file. The first of these is used:
+//
+//   - $TMUX_CONF
+//   - the file the running tmux server loaded (e.g. with tmux -f), when client is not nil
+//   - the file found by GetConfigFilePath
+func FindConfigFile(ctx context.Context, logger *slog.Logger, client Client) (string, error) {
+	if path := os.Getenv(ConfigEnvVar); path != "" {
+		logger.Debug("using conf file from environment", "path", path)
+		return CheckConfigFile(expandHome(path))
 	}
-
-	if configPath == "" {
-		logger.Debug("HOME is set")
-		home := os.Getenv("HOME")
-		configPath = filepath.Join(home, ".config", "tmux", "tmux.conf")
-	}
-
-	if _, err := os.Stat(configPath); err == nil {
-		return configPath, nil
-	} else if os.IsNotExist(err) {
-		logger.Debug("conf file not found in initial place, checking .tmux", "path", configPath)
-		home := os.Getenv("HOME")
-		configPath = filepath.Join(home, ".tmux.conf")
-
-		if _, err = os.Stat(configPath); err == nil {
-			return configPath, nil
-		} else if os.IsNotExist(err) {
-			return "", errors.New("failed to find tmux conf file at $XDG_CONFIG_HOME/tmux/tmux.conf, $HOME/tmux/tmux.conf, and $HOME/.tmux.conf")
-		} else {
-			return "", fmt.Errorf("failed to check if file exists: %w", err)
+	if client != nil {
+		path, err := loadedConfigFile(ctx, client)
+		if err != nil {
+			// the conf file can still be found on disk when the server cannot be reached
+			logger.Debug("failed to ask tmux server for its conf file", "error", err)
+		} else if path != "" {
+			logger.Debug("using conf file loaded by tmux server", "path", path)
+			return path, nil
 		}
-
-	} else {
-		return "", fmt.Errorf("failed to check if file exists: %w", err)
 	}
+	return GetConfigFilePath(logger)
 }
 
-func GetPlugins(path string) ([]string, error) {
-	f, err := os.Open(path)
+// loadedConfigFile returns the tmux conf file the running tmux server loaded. When it loaded
+// several, the file of the user is preferred over /etc/tmux.conf. An empty path is returned when
+// the server does not report its files (before tmux 3.2) or none of them exist.
+func loadedConfigFile(ctx context.Context, client Client) (string, error) {
+	out, err := client.DisplayMessage(ctx, "#{config_files}")
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return "", err
 	}
-	defer f.Close()
-
-	var plugins []string
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if strings.HasPrefix("#", line) {
+	var system string
+	for _, path := range strings.Split(out, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
 			continue
 		}
-
-		line = strings.TrimSpace(line)
-
-		if line == "" {
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
 			continue
 		}
+		if path == SystemConfigPath {
+			system = path
+			continue
+		}
+		return path, nil
+	}
+	return system, nil
+}
 
-		matches := pluginRegex.FindStringSubmatch(line)
-		if len(matches) == 2 {
-			plugins = append(plugins, matches[1])
+// CheckConfigFile returns the absolute path of the tmux conf file at the path, failing if it does
+// not exist.
+func CheckConfigFile(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine absolute path of "+path+": %w", err)
+	}
+	if _, err = os.Stat(absPath); err != nil {
+		if os.IsNotExist(err) {
+			return "", errors.New("tmux conf file " + path + " does not exist")
 		}
+		return "", fmt.Errorf("failed to check if file exists: %w", err)
 	}
+	return absPath, nil
+}
 
-	if err = scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+// GetConfigFilePath returns the first tmux conf file that exists of $XDG_CONFIG_HOME/tmux/tmux.conf
+// (or $HOME/.config/tmux/tmux.conf), $HOME/.tmux.conf and /etc/tmux.conf.
+func GetConfigFilePath(logger *slog.Logger) (string, error) {
+	xdgConfigHome := os.Getenv("XDG_CONFIG_HOME")
+
+	var configPath string
+	if xdgConfigHome != "" {
+		logger.Debug("XDF_CONFIG_HOME is set")
+		configPath = filepath.Join(xdgConfigHome, "tmux", "tmux.conf")
 	}
 
-	return plugins, nil
-}
+	if configPath == "" {
+		logger.Debug("HOME is set")
+		home := os.Getenv("HOME")
+		configPath = filepath.Join(home, ".config", "tmux", "tmux.conf")
+	}
 
-var pluginRegex = regexp.MustCompile(`^\s*set\s+-g\s+@plugin\s+['"]([^'"]+)['"]`)
+	home := os.Getenv("HOME")
+	for _, path := range []string{configPath, filepath.Join(home, ".tmux.conf"), SystemConfigPath} {
+		_, err := os.Stat(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to check if file exists: %w", err)
+		}
+		logger.Debug("conf file not found, checking the next place", "path", path)
+	}
+	return "", errors.New("failed to find tmux conf file at $XDG_CONFIG_HOME/tmux/tmux.conf, $HOME/.config/tmux/tmux.conf, $HOME/.tmux.conf and /etc/tmux.conf")
+}
 
 func HasPermissions(rootPath string) bool {
 	tempFile, err := os.CreateTemp(rootPath, "testFile-*")
@@ -97,116 +127,131 @@ func HasPermissions(rootPath string) bool {
 	return true
 }
 
+// ParsePlugin parses a plugin declared in the tmux conf file.
+//
+// A plugin can be declared as a GitHub shorthand (<owner>/<repo>), a full git URL
+// (https://, ssh://, git://, file://), a scp-like address (git@host:owner/repo) or a
+// local path. The declaration can be suffixed with #<ref> to pin the plugin to a branch, tag,
+// commit or semver constraint (see git.ParseRef).
+//
+// Relative local paths (./ or ../) are kept as they are. Use Declaration.Parse to resolve them
+// from the file declaring the plugin.
 func ParsePlugin(plugin string) (Plugin, error) {
-	parts := strings.SplitN(plugin, "#", 2)
-	otherParts := strings.SplitN(parts[0], "/", 2)
+	return parsePlugin(plugin, "")
+}
+
+// Parse parses the declared plugin like ParsePlugin. Relative local paths (./ or ../) are
+// resolved from the directory of the file the plugin is declared in.
+func (d Declaration) Parse() (Plugin, error) {
+	return parsePlugin(d.Plugin, filepath.Dir(d.File))
+}
 
-	if len(otherParts) != 2 {
-		return Plugin{}, errors.New("expected plugin to be in format <owner>/<repo>: " + plugin)
+// parsePlugin parses the plugin, resolving relative local paths from the directory when it is
+// not empty.
+func parsePlugin(plugin string, dir string) (Plugin, error) {
+	source, ref, _ := strings.Cut(strings.TrimSpace(plugin), "#")
+	if source == "" {
+		return Plugin{}, errors.New("plugin cannot be empty")
 	}
 
-	var branch string
-	if len(parts) == 2 {
-		branch = parts[1]
+	var url string
+	var path string
+	switch {
+	case strings.Contains(source, "://"):
+		url = source
+		_, rest, _ := strings.Cut(source, "://")
+		if i := strings.Index(rest, "/"); i >= 0 {
+			path = rest[i:]
+		}
+	case isLocalPath(source):
+		url = expandHome(source)
+		if dir != "" && !filepath.IsAbs(url) {
+			url = filepath.Join(dir, url)
+		}
+		path = url
+	case isSCPLike(source):
+		url = source
+		_, path, _ = strings.Cut(source, ":")
+	default:
+		parts := strings.Split(source, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return Plugin{}, errors.New("expected plugin to be in format <owner>/<repo> or a git URL: " + plugin)
+		}
+		url = "https://git::@github.com/" + source
+		path = source
+	}
+
+	owner, repo := splitRepoPath(path)
+	if repo == "" {
+		return Plugin{}, errors.New("failed to determine repository name of plugin: " + plugin)
 	}
 
 	return Plugin{
-		Owner:  otherParts[0],
-		Repo:   otherParts[1],
-		Branch: branch,
+		Owner: owner,
+		Repo:  repo,
+		Ref:   git.ParseRef(ref),
+		URL:   url,
 	}, nil
 }
 
-type Plugin struct {
-	Owner  string
-	Repo   string
-	Branch string
+// isLocalPath determines if the source is a path on the local file system.
+func isLocalPath(source string) bool {
+	return strings.HasPrefix(source, "/") ||
+		strings.HasPrefix(source, "./") ||
+		strings.HasPrefix(source, "../") ||
+		strings.HasPrefix(source, "~")
 }
 
-func CreatePluginsDir(path string) error {
-	err := os.MkdirAll(path, os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("failed create plugin directory: %w", err)
-	}
-	return nil
+// isSCPLike determines if the source is a scp-like git address (e.g. git@github.com:owner/repo).
+func isSCPLike(source string) bool {
+	host, _, found := strings.Cut(source, ":")
+	return found && host != "" && !strings.Contains(host, "/")
 }
 
-func SetDefaultTPMPath(logger *slog.Logger) error {
-	isSet := true
-	if err := checkIfDefaultEnvSet(); err != nil {
-		if errors.Is(err, errDefaultEnvNotSet) {
-			logger.Debug("default env path has not been set")
-			isSet = false
-		} else {
-			return err
-		}
-	}
-
-	if !isSet {
-		conf, err := GetConfigFilePath(logger)
-		if err != nil {
-			return err
-		}
-		rootDir := filepath.Dir(conf)
-
-		var tpmPath string
-		if strings.Contains(rootDir, ".config") {
-			tpmPath = filepath.Join(rootDir, "plugins")
-		} else {
-			tpmPath = filepath.Join(rootDir, ".tmux", "plugins")
-		}
-
-		cmd := exec.Command("tmux", "set-environment", "-g", "$DEFAULT_TPM_ENV_VAR_NAME", tpmPath)
-
-		out, err := cmd.CombinedOutput()
-		logger.Debug("attempted to set $DEFAULT_TPM_ENV_VAR_NAME", "out", out)
-		if err != nil {
-			return fmt.Errorf("failed to set $DEFAULT_TPM_ENV_VAR_NAME: %w", err)
-		}
-	} else {
-		logger.Debug("default tpm path has been set already")
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
 	}
-	return nil
+	return path
 }
 
-func checkIfDefaultEnvSet() error {
-	cmd := exec.Command("tmux", "show-environment", "-g", "$DEFAULT_TPM_ENV_VAR_NAME")
-	if err := cmd.Run(); err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			switch exitError.ExitCode() {
-			case 1:
-				return errDefaultEnvNotSet
-			default:
-				return fmt.Errorf("failed determine if $DEFAULT_TPM_ENV_VAR_NAME is set: %s", exitError.Error())
-			}
+// splitRepoPath returns the last two segments of the path of the repository with
+// any ".git" suffix removed.
+func splitRepoPath(path string) (string, string) {
+	var segments []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			segments = append(segments, s)
 		}
 	}
-	return nil
-
+	if len(segments) == 0 {
+		return "", ""
+	}
+	repo := strings.TrimSuffix(segments[len(segments)-1], ".git")
+	var owner string
+	if len(segments) > 1 {
+		owner = segments[len(segments)-2]
+	}
+	return owner, repo
 }
 
-var errDefaultEnvNotSet = errors.New("default env is not set")
-
-func GetOption(option string) (string, error) {
-	cmd := exec.Command("tmux", "show-option", "-gqv", option)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			switch exitError.ExitCode() {
-			case 1:
-				return "", nil
-			default:
-				return "", fmt.Errorf("failed to find option for "+option+": %w", err)
-			}
-		}
-	}
-	return strings.TrimSpace(string(out)), nil
+// Plugin is a plugin declared in the tmux conf file.
+type Plugin struct {
+	// Owner is the owner of the repository. It may be empty for local paths.
+	Owner string
+	// Repo is the name of the repository. It is also the name of the directory
+	// the plugin is installed to.
+	Repo string
+	// Ref is the ref the plugin is pinned to. When empty, the default branch is used.
+	Ref git.Ref
+	// URL is the URL used to clone the plugin.
+	URL string
 }
 
-func BindKey(key string, command string) error {
-	cmd := exec.Command("tmux", "bind-key", key, "run-shell", command)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to bind key "+key+" to "+command+": %w", err)
+func CreatePluginsDir(path string) error {
+	err := os.MkdirAll(path, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed create plugin directory: %w", err)
 	}
 	return nil
 }
@@ -1,10 +1,17 @@
 package tmux_test
 
 import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/Piszmog/gtpm/git"
 	"github.com/Piszmog/gtpm/tmux"
+	"github.com/Piszmog/gtpm/tmux/tmuxtest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -61,6 +68,183 @@ set -g @plugin 'odedlaz/tmux-onedark-theme'
 			},
 			err: nil,
 		},
+		{
+			name:            "Set Option",
+			rawFile:         `set-option -g @plugin 'tmux-plugins/tmux-sensible'`,
+			expectedPlugins: []string{"tmux-plugins/tmux-sensible"},
+			err:             nil,
+		},
+		{
+			name:            "Append",
+			rawFile:         `set -ga @plugin "tmux-plugins/tmux-sensible"`,
+			expectedPlugins: []string{"tmux-plugins/tmux-sensible"},
+			err:             nil,
+		},
+		{
+			name:            "Unquoted",
+			rawFile:         `set -g @plugin tmux-plugins/tmux-sensible`,
+			expectedPlugins: []string{"tmux-plugins/tmux-sensible"},
+			err:             nil,
+		},
+		{
+			name:            "Indented",
+			rawFile:         "\t  set -g @plugin 'tmux-plugins/tmux-sensible'",
+			expectedPlugins: []string{"tmux-plugins/tmux-sensible"},
+			err:             nil,
+		},
+		{
+			name:            "Branch",
+			rawFile:         `set -g @plugin 'tmux-plugins/tmux-sensible#dev'`,
+			expectedPlugins: []string{"tmux-plugins/tmux-sensible#dev"},
+			err:             nil,
+		},
+		{
+			name: "Trailing Comments",
+			rawFile: `
+set -g @plugin 'tmux-plugins/tmux-sensible' # sensible defaults
+set -g @plugin tmux-plugins/tmux-yank#main # the branch is not a comment
+`,
+			expectedPlugins: []string{
+				"tmux-plugins/tmux-sensible",
+				"tmux-plugins/tmux-yank#main",
+			},
+			err: nil,
+		},
+		{
+			name: "Indented Comment",
+			rawFile: `
+  # set -g @plugin 'tmux-plugins/tmux-sensible'
+set -g @plugin 'tmux-plugins/tmux-yank'
+`,
+			expectedPlugins: []string{"tmux-plugins/tmux-yank"},
+			err:             nil,
+		},
+		{
+			name: "Line Continuation",
+			rawFile: `
+set -g \
+  @plugin \
+  'tmux-plugins/tmux-sensible'
+`,
+			expectedPlugins: []string{"tmux-plugins/tmux-sensible"},
+			err:             nil,
+		},
+		{
+			name:            "Multiple Commands on a Line",
+			rawFile:         `set -g mouse on; set -g @plugin 'tmux-plugins/tmux-sensible' ; set -g @plugin 'tmux-plugins/tmux-yank'`,
+			expectedPlugins: []string{"tmux-plugins/tmux-sensible", "tmux-plugins/tmux-yank"},
+			err:             nil,
+		},
+		{
+			name:            "Escaped Semicolon",
+			rawFile:         `bind r source-file ~/.tmux.conf \; display "set -g @plugin 'tmux-plugins/tmux-sensible'"`,
+			expectedPlugins: nil,
+			err:             nil,
+		},
+		{
+			name: "Braces",
+			rawFile: `
+bind r {
+  set -g @plugin 'tmux-plugins/tmux-sensible'
+}
+set -g @plugin 'tmux-plugins/tmux-yank'
+`,
+			expectedPlugins: []string{"tmux-plugins/tmux-yank"},
+			err:             nil,
+		},
+		{
+			name:            "Unset",
+			rawFile:         `set -gu @plugin`,
+			expectedPlugins: nil,
+			err:             nil,
+		},
+		{
+			name:            "Other Option",
+			rawFile:         `set -g @plugin-option 'tmux-plugins/tmux-sensible'`,
+			expectedPlugins: nil,
+			err:             nil,
+		},
+		{
+			name:            "Legacy tpm_plugins",
+			rawFile:         "set -g @tpm_plugins '\n  tmux-plugins/tmux-sensible\n  tmux-plugins/tmux-yank\n'",
+			expectedPlugins: []string{"tmux-plugins/tmux-sensible", "tmux-plugins/tmux-yank"},
+			err:             nil,
+		},
+		{
+			name: "Environment Variables",
+			rawFile: `
+OWNER=tmux-plugins
+set -g @plugin "$OWNER/tmux-sensible"
+set -g @plugin '$OWNER/tmux-yank'
+set -g @plugin ${OWNER}/tmux-resurrect
+`,
+			expectedPlugins: []string{
+				"tmux-plugins/tmux-sensible",
+				"$OWNER/tmux-yank",
+				"tmux-plugins/tmux-resurrect",
+			},
+			err: nil,
+		},
+		{
+			name: "Conditional with Format",
+			rawFile: `
+%if "#{==:#{host},work}"
+set -g @plugin 'tmux-plugins/tmux-sensible'
+%elif "#{==:#{host},home}"
+set -g @plugin 'tmux-plugins/tmux-yank'
+%else
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+%endif
+`,
+			expectedPlugins: []string{
+				"tmux-plugins/tmux-sensible",
+				"tmux-plugins/tmux-yank",
+				"tmux-plugins/tmux-resurrect",
+			},
+			err: nil,
+		},
+		{
+			name: "Conditional with Constants",
+			rawFile: `
+%if 0
+set -g @plugin 'tmux-plugins/tmux-sensible'
+%elif 1
+set -g @plugin 'tmux-plugins/tmux-yank'
+%else
+set -g @plugin 'tmux-plugins/tmux-resurrect'
+%endif
+`,
+			expectedPlugins: []string{"tmux-plugins/tmux-yank"},
+			err:             nil,
+		},
+		{
+			name: "Nested Conditional",
+			rawFile: `
+%if 1
+  %if 0
+    set -g @plugin 'tmux-plugins/tmux-sensible'
+  %endif
+  set -g @plugin 'tmux-plugins/tmux-yank'
+%endif
+`,
+			expectedPlugins: []string{"tmux-plugins/tmux-yank"},
+			err:             nil,
+		},
+		{
+			name: "Missing endif",
+			rawFile: `
+%if 1
+set -g @plugin 'tmux-plugins/tmux-sensible'
+`,
+			expectedPlugins: nil,
+			err:             errors.New("missing %endif for %if on line 2"),
+		},
+		{
+			name:            "Unterminated Quote",
+			rawFile:         `set -g @plugin 'tmux-plugins/tmux-sensible`,
+			expectedPlugins: nil,
+			err:             errors.New("line 1: unterminated single quote"),
+		},
 	}
 
 	for _, test := range tests {
@@ -78,7 +262,7 @@ set -g @plugin 'odedlaz/tmux-onedark-theme'
 			plugins, err := tmux.GetPlugins(f.Name())
 			if test.err != nil {
 				require.Error(t, err)
-				assert.ErrorIs(t, err, test.err)
+				assert.Contains(t, err.Error(), test.err.Error())
 				assert.Nil(t, plugins)
 			} else {
 				require.NoError(t, err)
@@ -87,3 +271,393 @@ set -g @plugin 'odedlaz/tmux-onedark-theme'
 		})
 	}
 }
+
+func TestParsePlugin(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	tests := []struct {
+		name           string
+		plugin         string
+		expectedPlugin tmux.Plugin
+		expectedErr    string
+	}{
+		{
+			name:   "GitHub Shorthand",
+			plugin: "tmux-plugins/tmux-sensible",
+			expectedPlugin: tmux.Plugin{
+				Owner: "tmux-plugins",
+				Repo:  "tmux-sensible",
+				URL:   "https://git::@github.com/tmux-plugins/tmux-sensible",
+			},
+		},
+		{
+			name:   "GitHub Shorthand with Branch",
+			plugin: "tmux-plugins/tmux-sensible#dev",
+			expectedPlugin: tmux.Plugin{
+				Owner: "tmux-plugins",
+				Repo:  "tmux-sensible",
+				Ref:   git.Ref{Type: git.RefBranch, Name: "dev"},
+				URL:   "https://git::@github.com/tmux-plugins/tmux-sensible",
+			},
+		},
+		{
+			name:   "GitHub Shorthand with Tag",
+			plugin: "tmux-plugins/tmux-sensible#v1.2.0",
+			expectedPlugin: tmux.Plugin{
+				Owner: "tmux-plugins",
+				Repo:  "tmux-sensible",
+				Ref:   git.Ref{Type: git.RefTag, Name: "v1.2.0"},
+				URL:   "https://git::@github.com/tmux-plugins/tmux-sensible",
+			},
+		},
+		{
+			name:   "GitHub Shorthand with Commit",
+			plugin: "tmux-plugins/tmux-sensible#25cb91f",
+			expectedPlugin: tmux.Plugin{
+				Owner: "tmux-plugins",
+				Repo:  "tmux-sensible",
+				Ref:   git.Ref{Type: git.RefCommit, Name: "25cb91f"},
+				URL:   "https://git::@github.com/tmux-plugins/tmux-sensible",
+			},
+		},
+		{
+			name:   "GitHub Shorthand with Semver",
+			plugin: "tmux-plugins/tmux-sensible#^1.2",
+			expectedPlugin: tmux.Plugin{
+				Owner: "tmux-plugins",
+				Repo:  "tmux-sensible",
+				Ref:   git.Ref{Type: git.RefSemver, Name: "^1.2"},
+				URL:   "https://git::@github.com/tmux-plugins/tmux-sensible",
+			},
+		},
+		{
+			name:   "HTTPS",
+			plugin: "https://gitlab.example.com/group/tmux-plugin.git",
+			expectedPlugin: tmux.Plugin{
+				Owner: "group",
+				Repo:  "tmux-plugin",
+				URL:   "https://gitlab.example.com/group/tmux-plugin.git",
+			},
+		},
+		{
+			name:   "SSH",
+			plugin: "ssh://git@gitlab.example.com:2222/group/sub/tmux-plugin#main",
+			expectedPlugin: tmux.Plugin{
+				Owner: "sub",
+				Repo:  "tmux-plugin",
+				Ref:   git.Ref{Type: git.RefBranch, Name: "main"},
+				URL:   "ssh://git@gitlab.example.com:2222/group/sub/tmux-plugin",
+			},
+		},
+		{
+			name:   "SCP-like",
+			plugin: "git@bitbucket.com:user/plugin",
+			expectedPlugin: tmux.Plugin{
+				Owner: "user",
+				Repo:  "plugin",
+				URL:   "git@bitbucket.com:user/plugin",
+			},
+		},
+		{
+			name:   "File URL",
+			plugin: "file:///srv/git/plugin.git",
+			expectedPlugin: tmux.Plugin{
+				Owner: "git",
+				Repo:  "plugin",
+				URL:   "file:///srv/git/plugin.git",
+			},
+		},
+		{
+			name:   "Local Path",
+			plugin: "~/src/plugin",
+			expectedPlugin: tmux.Plugin{
+				Owner: "src",
+				Repo:  "plugin",
+				URL:   "/home/user/src/plugin",
+			},
+		},
+		{
+			name:        "Missing Owner",
+			plugin:      "tmux-sensible",
+			expectedErr: "expected plugin to be in format <owner>/<repo> or a git URL: tmux-sensible",
+		},
+		{
+			name:        "Empty",
+			plugin:      "",
+			expectedErr: "plugin cannot be empty",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin, err := tmux.ParsePlugin(test.plugin)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, test.expectedErr, err.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, test.expectedPlugin, plugin)
+			}
+		})
+	}
+}
+
+func TestDeclaration_Parse(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	tests := []struct {
+		name           string
+		declaration    tmux.Declaration
+		expectedPlugin tmux.Plugin
+	}{
+		{
+			name:           "Relative Path",
+			declaration:    tmux.Declaration{Plugin: "./plugins/tmux-local", File: "/home/user/.config/tmux/tmux.conf"},
+			expectedPlugin: tmux.Plugin{Owner: "plugins", Repo: "tmux-local", URL: "/home/user/.config/tmux/plugins/tmux-local"},
+		},
+		{
+			name:           "Parent Path",
+			declaration:    tmux.Declaration{Plugin: "../src/tmux-local#dev", File: "/home/user/.config/tmux/plugins.conf"},
+			expectedPlugin: tmux.Plugin{Owner: "src", Repo: "tmux-local", Ref: git.Ref{Type: git.RefBranch, Name: "dev"}, URL: "/home/user/.config/src/tmux-local"},
+		},
+		{
+			name:           "Home Path",
+			declaration:    tmux.Declaration{Plugin: "~/src/tmux-local", File: "/etc/tmux.conf"},
+			expectedPlugin: tmux.Plugin{Owner: "src", Repo: "tmux-local", URL: "/home/user/src/tmux-local"},
+		},
+		{
+			name:           "GitHub Shorthand",
+			declaration:    tmux.Declaration{Plugin: "tmux-plugins/tmux-sensible", File: "/etc/tmux.conf"},
+			expectedPlugin: tmux.Plugin{Owner: "tmux-plugins", Repo: "tmux-sensible", URL: "https://git::@github.com/tmux-plugins/tmux-sensible"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plugin, err := test.declaration.Parse()
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedPlugin, plugin)
+		})
+	}
+}
+
+func TestFindPlugins(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("PLUGINS_DIR", filepath.Join(dir, "plugins.d"))
+
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	confPath := writeFile("tmux.conf", `
+set -g @plugin 'tmux-plugins/tmux-sensible'
+source-file ~/.config/tmux/theme.conf
+source -q ~/missing.conf
+source-file "$PLUGINS_DIR/*.conf" # load everything
+set -g @plugin 'tmux-plugins/tmux-yank'
+`)
+	themePath := writeFile(".config/tmux/theme.conf", `
+set -g @plugin 'odedlaz/tmux-onedark-theme'
+source-file ../../tmux.conf
+`)
+	aPath := writeFile("plugins.d/a.conf", `set -g @plugin 'tmux-plugins/tmux-resurrect'`)
+	bPath := writeFile("plugins.d/b.conf", `
+source-file -q ../plugins.d/a.conf
+set -g @plugin 'tmux-plugins/tmux-continuum'
+`)
+
+	declarations, err := tmux.FindPlugins(confPath)
+	require.NoError(t, err)
+	assert.Equal(t, []tmux.Declaration{
+		{Plugin: "tmux-plugins/tmux-sensible", File: confPath, Line: 2},
+		{Plugin: "odedlaz/tmux-onedark-theme", File: themePath, Line: 2},
+		{Plugin: "tmux-plugins/tmux-resurrect", File: aPath, Line: 1},
+		{Plugin: "tmux-plugins/tmux-continuum", File: bPath, Line: 3},
+		{Plugin: "tmux-plugins/tmux-yank", File: confPath, Line: 6},
+	}, declarations)
+
+	missingPath := writeFile("missing-source.conf", `source-file ~/missing.conf`)
+	_, err = tmux.FindPlugins(missingPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such file: "+filepath.Join(dir, "missing.conf"))
+}
+
+func TestFindSettings(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "tmux.conf")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "extra.conf"), []byte(`
+set -g @gtpm-plugin-dir '~/plugins'
+set -gu @removed
+`), 0o644))
+	require.NoError(t, os.WriteFile(confPath, []byte(`
+set -g @gtpm-plugin-dir 'first'
+set -g @removed 'yes'
+set -go @theme 'dark'
+set -go @theme 'light'
+set -g status-left 'not a user option'
+set-environment -g TMUX_PLUGIN_MANAGER_PATH '/plugins/'
+setenv -g REMOVED 1
+setenv -gu REMOVED
+set-environment SESSION_ONLY 1
+source-file extra.conf
+`), 0o644))
+
+	settings, err := tmux.FindSettings(confPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"@gtpm-plugin-dir": "~/plugins",
+		"@theme":           "dark",
+	}, settings.Options)
+	assert.Equal(t, map[string]string{"TMUX_PLUGIN_MANAGER_PATH": "/plugins/"}, settings.Environment)
+}
+
+func TestPluginsDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("TMUX_PLUGIN_MANAGER_PATH", "")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name     string
+		confPath string
+		conf     string
+		env      string
+		tmuxEnv  map[string]string
+		expected string
+	}{
+		{
+			name:     "XDG Layout",
+			confPath: filepath.Join(home, ".config", "tmux", "tmux.conf"),
+			expected: filepath.Join(home, ".config", "tmux", "plugins"),
+		},
+		{
+			name:     "Home Layout",
+			confPath: filepath.Join(home, ".tmux.conf"),
+			expected: filepath.Join(home, ".tmux", "plugins"),
+		},
+		{
+			name:     "Option",
+			confPath: filepath.Join(home, ".tmux.conf"),
+			conf:     `set -g @gtpm-plugin-dir '~/.local/share/tmux/plugins/'`,
+			env:      "/env",
+			expected: filepath.Join(home, ".local", "share", "tmux", "plugins"),
+		},
+		{
+			name:     "Environment",
+			confPath: filepath.Join(home, ".tmux.conf"),
+			env:      "/env/",
+			tmuxEnv:  map[string]string{"TMUX_PLUGIN_MANAGER_PATH": "/tmux-env/"},
+			expected: "/env",
+		},
+		{
+			name:     "Tmux Environment",
+			confPath: filepath.Join(home, ".tmux.conf"),
+			conf:     `set-environment -g TMUX_PLUGIN_MANAGER_PATH '/conf/'`,
+			tmuxEnv:  map[string]string{"TMUX_PLUGIN_MANAGER_PATH": "/tmux-env/"},
+			expected: "/tmux-env",
+		},
+		{
+			name:     "Conf File Environment",
+			confPath: filepath.Join(home, ".tmux.conf"),
+			conf:     `set-environment -g TMUX_PLUGIN_MANAGER_PATH '/conf/'`,
+			expected: "/conf",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.NoError(t, os.MkdirAll(filepath.Dir(test.confPath), os.ModePerm))
+			require.NoError(t, os.WriteFile(test.confPath, []byte(test.conf), 0o644))
+			t.Setenv("TMUX_PLUGIN_MANAGER_PATH", test.env)
+			client := tmuxtest.NewFake()
+			for k, v := range test.tmuxEnv {
+				client.Environment[k] = v
+			}
+
+			dir, err := tmux.PluginsDir(context.Background(), logger, client, test.confPath)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, dir)
+		})
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("TMUX_CONF", "")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	homeConf := filepath.Join(home, ".tmux.conf")
+	serverConf := filepath.Join(home, "server.conf")
+	envConf := filepath.Join(home, "env.conf")
+	for _, path := range []string{homeConf, serverConf, envConf} {
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	tests := []struct {
+		name        string
+		env         string
+		configFiles string
+		expected    string
+	}{
+		{
+			name:     "On Disk",
+			expected: homeConf,
+		},
+		{
+			name:        "Loaded By Server",
+			configFiles: "/etc/tmux.conf," + serverConf,
+			expected:    serverConf,
+		},
+		{
+			name:        "Loaded Files Missing",
+			configFiles: filepath.Join(home, "missing.conf"),
+			expected:    homeConf,
+		},
+		{
+			name:        "Environment",
+			env:         "~/env.conf",
+			configFiles: serverConf,
+			expected:    envConf,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TMUX_CONF", test.env)
+			client := tmuxtest.NewFake()
+			client.Formats["#{config_files}"] = test.configFiles
+
+			path, err := tmux.FindConfigFile(context.Background(), logger, client)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, path)
+		})
+	}
+
+	t.Setenv("TMUX_CONF", filepath.Join(home, "missing.conf"))
+	_, err := tmux.FindConfigFile(context.Background(), logger, nil)
+	require.ErrorContains(t, err, "missing.conf does not exist")
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		expected string
+	}{
+		{name: "Plain", s: "/usr/bin/gtpm", expected: "'/usr/bin/gtpm'"},
+		{name: "Spaces", s: "my conf", expected: "'my conf'"},
+		{name: "Single Quote", s: "ci's.conf", expected: `'ci'\''s.conf'`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, tmux.ShellQuote(test.s))
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Package tmuxtest provides a tmux.Client for tests that records the commands it is sent.
+package tmuxtest
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/Piszmog/gtpm/tmux"
+)
+
+// Fake is a tmux.Client that records every command as the arguments that would be passed to
+// the tmux executable, without a running tmux server.
+type Fake struct {
+	// Environment is the global environment of the fake server.
+	Environment map[string]string
+	// Options are the global options of the fake server.
+	Options map[string]string
+	// TmuxVersion is the version Version returns.
+	TmuxVersion string
+	// Formats are the expansions of the formats passed to DisplayMessage. Other formats expand to
+	// an empty string.
+	Formats map[string]string
+
+	mu       sync.Mutex
+	commands [][]string
+}
+
+var _ tmux.Client = (*Fake)(nil)
+
+// NewFake creates a Fake of tmux 3.4 with an empty environment and no options or formats set.
+func NewFake() *Fake {
+	return &Fake{
+		TmuxVersion: "3.4",
+		Environment: make(map[string]string),
+		Options:     make(map[string]string),
+		Formats:     make(map[string]string),
+	}
+}
+
+// Commands returns the commands sent to the Fake in the order they were sent.
+func (f *Fake) Commands() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.commands)
+}
+
+func (f *Fake) record(args ...string) {
+	f.commands = append(f.commands, args)
+}
+
+func (f *Fake) Version(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("-V")
+	return f.TmuxVersion, nil
+}
+
+func (f *Fake) ShowEnvironment(ctx context.Context, name string) (string, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("show-environment", "-g", name)
+	value, ok := f.Environment[name]
+	return value, ok, nil
+}
+
+func (f *Fake) SetEnvironment(ctx context.Context, name string, value string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("set-environment", "-g", name, value)
+	f.Environment[name] = value
+	return nil
+}
+
+func (f *Fake) GetOption(ctx context.Context, option string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("show-option", "-gqv", option)
+	return f.Options[option], nil
+}
+
+func (f *Fake) BindKey(ctx context.Context, key string, command string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("bind-key", key, "run-shell", command)
+	return nil
+}
+
+func (f *Fake) DisplayMessage(ctx context.Context, format string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("display-message", "-p", format)
+	return f.Formats[format], nil
+}
+
+func (f *Fake) DisplayPopup(ctx context.Context, title string, command string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("display-popup", "-E", "-T", title, command)
+	return nil
+}